@@ -0,0 +1,201 @@
+/**
+ * @Author : liangliangtoo
+ * @File : accesslog
+ * @Date: 2026/10/19 02:40
+ * @Description: 访问日志，每个请求记录一行结构化日志
+ */
+package Trpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/LucienVen/Trpc/core"
+)
+
+/**
+使用方式：
+	f, _ := Trpc.OpenRotatingFile("access.log", 100<<20, 5)
+	server.AccessLog = Trpc.NewAccessLog(f)
+或直接写入任意 io.Writer：
+	server.AccessLog = Trpc.NewAccessLog(os.Stdout)
+Server.AccessLog 为 nil 时不记录；普通调用、单向调用与批量调用各记录一行，流不记录
+*/
+
+// AccessRecord 一次请求的访问记录
+type AccessRecord struct {
+	Time          time.Time     `json:"time"`                // 请求读取完成的时间
+	Remote        string        `json:"remote"`              // 客户端地址
+	Principal     string        `json:"principal,omitempty"` // Server.Authenticate 返回的主体
+	ServiceMethod string        `json:"method"`
+	Seq           uint64        `json:"seq"`
+	RequestSize   uint64        `json:"requestSize"`  // 请求头与请求体的字节数
+	ResponseSize  uint64        `json:"responseSize"` // 响应的字节数，单向调用为0
+	Latency       time.Duration `json:"latency"`      // 从读取完成到回复完成，单位纳秒
+	Code          string        `json:"code"`
+	Error         string        `json:"error,omitempty"`
+}
+
+// AccessLogger 访问日志的输出，需要支持并发调用
+type AccessLogger interface {
+	LogAccess(record *AccessRecord) error
+}
+
+// 记录访问日志
+func (s *Server) access(sc *serverConn, h *core.Header, start time.Time, reqSize, respSize uint64, err error) {
+	if s.AccessLog == nil {
+		return
+	}
+
+	record := &AccessRecord{
+		Time:          start,
+		Remote:        sc.remoteAddr,
+		Principal:     sc.principal,
+		ServiceMethod: h.ServiceMethod,
+		Seq:           h.Seq,
+		RequestSize:   reqSize,
+		ResponseSize:  respSize,
+		Latency:       time.Since(start),
+		Code:          ErrorCode(err).String(),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if err = s.AccessLog.LogAccess(record); err != nil {
+		s.logger().Log(LevelWarn, "rpc server: write access log error", F("err", err))
+	}
+}
+
+// AccessLog 每条记录写为一行 JSON
+type AccessLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewAccessLog 将访问记录写入 w
+func NewAccessLog(w io.Writer) *AccessLog {
+	return &AccessLog{w: w}
+}
+
+func (l *AccessLog) LogAccess(record *AccessRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.w.Write(append(line, '\n'))
+	return err
+}
+
+// Close 关闭底层的 io.Writer（如果可以关闭）
+func (l *AccessLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if c, ok := l.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+/** 按大小轮转的文件 **/
+
+// RotatingFile 文件超过 maxSize 后依次重命名为 path.1 ... path.N，最多保留 maxBackups 个
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// OpenRotatingFile 打开（追加写入）轮转文件，maxSize<=0 代表不轮转
+func OpenRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+// Write 写入 p，写入后超过 maxSize 时先轮转，单次写入不会被拆分到两个文件
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil {
+		return 0, os.ErrClosed
+	}
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// 关闭当前文件，path.i 重命名为 path.i+1，path 重命名为 path.1，再打开新文件（需持有锁）
+func (r *RotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	r.f = nil
+
+	if r.maxBackups <= 0 {
+		if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return r.open()
+	}
+
+	_ = os.Remove(r.backup(r.maxBackups))
+	for i := r.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(r.backup(i), r.backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(r.path, r.backup(1)); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+func (r *RotatingFile) backup(i int) string {
+	return fmt.Sprintf("%s.%d", r.path, i)
+}
+
+// Close 关闭文件
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
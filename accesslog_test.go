@@ -0,0 +1,107 @@
+package Trpc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LucienVen/Trpc/core"
+)
+
+// 记录到 channel 的 AccessLogger，访问日志在回复之后写入
+type chanAccessLog chan *AccessRecord
+
+func (c chanAccessLog) LogAccess(record *AccessRecord) error {
+	c <- record
+	return nil
+}
+
+func TestServer_AccessLog(t *testing.T) {
+	t.Parallel()
+
+	records := make(chanAccessLog, 2)
+	server := NewServer()
+	server.AccessLog = records
+	server.Authenticate = func(remoteAddr, credential string) (string, error) {
+		return credential, nil
+	}
+	var foo Foo
+	_ = server.Register(&foo)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+
+	client, _ := Dial("tcp", l.Addr().String(), &Option{Credential: "alice"})
+	defer func() { _ = client.Close() }()
+
+	var reply int
+	err := client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "call failed: %v", err)
+	r := <-records
+	_assert(r.ServiceMethod == "Foo.Sum" && r.Principal == "alice" && r.Code == "OK" && r.Error == "",
+		"unexpected record %+v", r)
+	_assert(r.RequestSize > 0 && r.ResponseSize > 0 && r.Latency > 0, "sizes and latency should be recorded: %+v", r)
+	_assert(strings.HasPrefix(r.Remote, "127.0.0.1:"), "unexpected remote %q", r.Remote)
+
+	err = client.Call(context.Background(), "Foo.Missing", Args{}, &reply)
+	_assert(err != nil, "expect an error for unknown method")
+	r = <-records
+	_assert(r.ServiceMethod == "Foo.Missing" && r.Code == CodeNotFound.String() && r.Error != "", "unexpected record %+v", r)
+}
+
+func TestServer_AccessLogJSON(t *testing.T) {
+	t.Parallel()
+
+	records := make(chanAccessLog, 2)
+	server := NewServer()
+	server.AccessLog = records
+	var foo Foo
+	_ = server.Register(&foo)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+
+	conn, _ := net.Dial("tcp", l.Addr().String())
+	defer func() { _ = conn.Close() }()
+	_ = json.NewEncoder(conn).Encode(&Option{MagicNumber: DefaultMagicNumber, CodecType: core.JosnType})
+
+	// 两个请求一次写入，json.Decoder 会预读第二个请求
+	first := `{"ServiceMethod":"Foo.Sum","Seq":1}` + "\n" + `{"Num1":1,"Num2":2}` + "\n"
+	second := `{"ServiceMethod":"Foo.Sum","Seq":2,"Meta":{"k":"v"}}` + "\n" + `{"Num1":10,"Num2":20}` + "\n"
+	_, _ = conn.Write([]byte(first + second))
+
+	sizes := map[uint64]uint64{}
+	for i := 0; i < 2; i++ {
+		r := <-records
+		sizes[r.Seq] = r.RequestSize
+	}
+	_assert(sizes[1] == uint64(len(first)) && sizes[2] == uint64(len(second)),
+		"expect request sizes %d and %d, but got %v", len(first), len(second), sizes)
+}
+
+func TestRotatingFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := OpenRotatingFile(path, 64, 2)
+	_assert(err == nil, "open failed: %v", err)
+	log := NewAccessLog(f)
+
+	for i := 0; i < 5; i++ {
+		_ = log.LogAccess(&AccessRecord{Time: time.Unix(0, 0).UTC(), ServiceMethod: "Foo.Sum", Seq: uint64(i)})
+	}
+	_ = log.Close()
+
+	// 每条记录超过 64 字节，每次写入前都会轮转，只保留最近的两个备份
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		data, err := os.ReadFile(name)
+		_assert(err == nil && strings.Count(string(data), "\n") == 1, "unexpected content of %s: %q", name, data)
+	}
+	_, err = os.Stat(path + ".3")
+	_assert(os.IsNotExist(err), "only two backups should be kept")
+	data, _ := os.ReadFile(path)
+	_assert(strings.Contains(string(data), `"seq":4`), "latest record should be in %s: %q", path, data)
+}
@@ -0,0 +1,175 @@
+/**
+ * @Author : liangliangtoo
+ * @File : batch
+ * @Date: 2026/10/18 13:40
+ * @Description: 批量调用，一次写入发送多个请求
+ */
+package Trpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/LucienVen/Trpc/core"
+)
+
+// BatchItem 批量调用中的一个请求，调用结束后 Error 保存该请求自身的错误
+type BatchItem struct {
+	ServiceMethod string
+	Args          interface{}
+	Reply         interface{}
+	Error         error
+}
+
+// 批量请求中的单个请求，参数按连接的编解码类型独立编码
+type batchArgs struct {
+	ServiceMethod string
+	Payload       []byte
+}
+
+// 批量响应中的单个响应，与请求一一对应
+type batchReply struct {
+	Payload []byte
+	Error   string
+	Code    Code
+	Meta    map[string]string // 错误携带的元数据，如 MetaRetryAfter
+}
+
+// Batch 将多个请求合并为一帧发送，服务端并发处理后一次性返回
+// 请求头与 GoContext 一样携带 ctx 中的优先级与 trace 上下文，批量中的每个请求都继承它们
+// 返回的错误表示整个批次失败（如连接断开），单个请求的错误保存在 items[i].Error
+func (client *Client) Batch(ctx context.Context, items []BatchItem) error {
+	args := make([]batchArgs, len(items))
+	for i := range items {
+		payload, err := core.Marshal(client.opt.CodecType, items[i].Args)
+		if err != nil {
+			return err
+		}
+		args[i] = batchArgs{ServiceMethod: items[i].ServiceMethod, Payload: payload}
+	}
+
+	var replies []batchReply
+	call := &Call{
+		Args:  args,
+		Reply: &replies,
+		Done:  make(chan *Call, 1),
+		kind:  core.KindBatch,
+		meta:  injectSpan(ctx, priorityMeta(ctx)),
+	}
+	client.send(call)
+
+	select {
+	case <-ctx.Done():
+		client.removeCall(call.Seq)
+		return contextError("rpc client: batch failed", ctx)
+	case call = <-call.Done:
+		if call.Error != nil {
+			return call.Error
+		}
+	}
+
+	if len(replies) != len(items) {
+		return errors.New("rpc client: batch reply count mismatch")
+	}
+
+	for i, r := range replies {
+		if r.Error != "" {
+			items[i].Error = &Error{Code: r.Code, Message: r.Error, Meta: r.Meta}
+			continue
+		}
+		items[i].Error = core.Unmarshal(client.opt.CodecType, r.Payload, items[i].Reply)
+	}
+
+	return nil
+}
+
+// 读取批量请求，并发处理后统一回复
+// consumed 为读取请求头之前已读取的字节数，用于计算请求大小
+func (s *Server) serveBatch(sc *serverConn, h *core.Header, consumed uint64) error {
+	var args []batchArgs
+	if err := sc.cc.ReadBody(&args); err != nil {
+		return err
+	}
+	start, size := time.Now(), sc.consumed()-consumed
+
+	sc.spawn(func() {
+		s.handleBatch(sc, h, args, start, size)
+	})
+	return nil
+}
+
+// 批量调用中的单个请求，回复写入批量响应的对应位置而不是连接
+type batchSlot struct {
+	reply *batchReply
+	codec core.Ttype
+	wg    *sync.WaitGroup
+}
+
+// 请求结束，每个请求只调用一次
+func (slot *batchSlot) done(req *request, err error) {
+	defer slot.wg.Done()
+	if err == nil {
+		var payload []byte
+		if payload, err = core.Marshal(slot.codec, req.replyv.Interface()); err == nil {
+			slot.reply.Payload = payload
+			return
+		}
+	}
+	slot.reply.fail(err)
+}
+
+func (r *batchReply) fail(err error) {
+	r.Error = err.Error()
+	r.Code = ErrorCode(err)
+	var e *Error
+	if errors.As(err, &e) {
+		r.Meta = e.Meta
+	}
+}
+
+// 批量中的每个请求与普通调用一样经过 dispatch：限流、并发限制、worker 池与处理超时，
+// 被拒绝的请求只有自身失败；整个批次只记录一条访问日志
+func (s *Server) handleBatch(sc *serverConn, h *core.Header, args []batchArgs, start time.Time, size uint64) {
+	replies := make([]batchReply, len(args))
+	var wg sync.WaitGroup
+	for i := range args {
+		req, err := s.batchRequest(sc, h, &args[i])
+		if err != nil {
+			replies[i].fail(err)
+			continue
+		}
+		req.start = start
+		req.slot = &batchSlot{reply: &replies[i], codec: sc.opt.CodecType, wg: &wg}
+
+		wg.Add(1)
+		s.dispatch(sc, req)
+	}
+	wg.Wait()
+
+	// 响应只携带服务端的元数据
+	h.Meta = nil
+	s.access(sc, h, start, size, s.respond(sc, h, replies), nil)
+}
+
+// 由批量中的单个请求构造 request，请求头继承批量请求头的元数据（优先级、trace 上下文）
+func (s *Server) batchRequest(sc *serverConn, h *core.Header, args *batchArgs) (*request, error) {
+	ih := &core.Header{ServiceMethod: args.ServiceMethod, Seq: h.Seq, Meta: h.Meta}
+	req := &request{h: ih, ctx: sc.ctx, meta: h.Meta}
+
+	var err error
+	req.svc, req.mtype, err = s.findService(args.ServiceMethod)
+	if err != nil {
+		return nil, err
+	}
+	if req.mtype.stream {
+		return nil, Errorf(CodeInvalidArgument, "rpc server: method is a stream: %s", args.ServiceMethod)
+	}
+
+	req.argv, req.replyv = req.mtype.newArgv(), req.mtype.newReplyv()
+	if err = core.Unmarshal(sc.opt.CodecType, args.Payload, argvInterface(req.argv)); err != nil {
+		return nil, Errorf(CodeInvalidArgument, "rpc server: read body err: %v", err)
+	}
+	return req, nil
+}
@@ -0,0 +1,275 @@
+/**
+ * @Author : liangliangtoo
+ * @File : breaker
+ * @Date: 2026/10/18 19:05
+ * @Description: 按后端地址熔断，后端异常时快速失败
+ */
+package Trpc
+
+import (
+	"sync"
+	"time"
+)
+
+/**
+状态转换：
+	closed    --(窗口内连续失败或错误率超过阈值)--> open
+	open      --(OpenTimeout 之后)------------------> half-open
+	half-open --(探测请求全部成功)------------------> closed
+	half-open --(任一探测请求失败)------------------> open
+*/
+
+// BreakerState 熔断器状态
+type BreakerState int
+
+const (
+	StateClosed BreakerState = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	default:
+		return "half-open"
+	}
+}
+
+var ErrBreakerOpen = &Error{Code: CodeUnavailable, Message: "rpc client: circuit breaker is open"}
+
+// BreakerOption 熔断器配置
+type BreakerOption struct {
+	Window              time.Duration    // 统计窗口，默认10s
+	ConsecutiveFailures int              // 连续失败次数阈值，默认5
+	ErrorRate           float64          // 窗口内错误率阈值（0~1），默认0.5
+	MinRequests         int              // 计算错误率所需的最少请求数，默认20
+	OpenTimeout         time.Duration    // 打开后经过多久进入半开状态，默认5s
+	HalfOpenRequests    int              // 半开状态下允许的探测请求数，默认1
+	IsFailure           func(error) bool // 判断错误是否计入失败，默认见 isBackendFailure
+}
+
+var DefaultBreakerOption = &BreakerOption{
+	Window:              time.Second * 10,
+	ConsecutiveFailures: 5,
+	ErrorRate:           0.5,
+	MinRequests:         20,
+	OpenTimeout:         time.Second * 5,
+	HalfOpenRequests:    1,
+}
+
+// 默认只有后端不可用、超时、过载和内部错误计入失败，处理函数返回的业务错误不影响熔断
+func isBackendFailure(err error) bool {
+	switch ErrorCode(err) {
+	case CodeUnavailable, CodeDeadlineExceeded, CodeResourceExhausted, CodeInternal:
+		return true
+	}
+	return false
+}
+
+// Breaker 单个后端的熔断器，可以单独包裹 Client.Call 使用
+type Breaker struct {
+	opt BreakerOption
+
+	mu          sync.Mutex
+	state       BreakerState
+	windowStart time.Time
+	requests    int // 窗口内的请求数
+	failures    int // 窗口内的失败数
+	consecutive int // 连续失败数
+	openedAt    time.Time
+	probes      int // 半开状态下已放行的探测请求
+	successes   int // 半开状态下成功的探测请求
+	generation  uint64 // 每次状态变化加1，用于忽略状态变化前放行的请求
+}
+
+// NewBreaker 创建熔断器，opt 为 nil 时使用默认配置
+func NewBreaker(opt *BreakerOption) *Breaker {
+	return &Breaker{opt: parseBreakerOption(opt), windowStart: time.Now()}
+}
+
+func parseBreakerOption(opt *BreakerOption) BreakerOption {
+	if opt == nil {
+		opt = DefaultBreakerOption
+	}
+
+	o := *opt
+	if o.Window <= 0 {
+		o.Window = DefaultBreakerOption.Window
+	}
+	if o.ConsecutiveFailures <= 0 {
+		o.ConsecutiveFailures = DefaultBreakerOption.ConsecutiveFailures
+	}
+	if o.ErrorRate <= 0 || o.ErrorRate > 1 {
+		o.ErrorRate = DefaultBreakerOption.ErrorRate
+	}
+	if o.MinRequests <= 0 {
+		o.MinRequests = DefaultBreakerOption.MinRequests
+	}
+	if o.OpenTimeout <= 0 {
+		o.OpenTimeout = DefaultBreakerOption.OpenTimeout
+	}
+	if o.HalfOpenRequests <= 0 {
+		o.HalfOpenRequests = DefaultBreakerOption.HalfOpenRequests
+	}
+	if o.IsFailure == nil {
+		o.IsFailure = isBackendFailure
+	}
+	return o
+}
+
+// State 当前状态
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refresh(time.Now())
+	return b.state
+}
+
+// Allow 判断是否放行请求，打开状态下返回 ErrBreakerOpen
+// 放行后必须以返回的 generation 调用 Done
+func (b *Breaker) Allow() (generation uint64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh(time.Now())
+	switch b.state {
+	case StateOpen:
+		return 0, ErrBreakerOpen
+	case StateHalfOpen:
+		if b.probes >= b.opt.HalfOpenRequests {
+			return 0, ErrBreakerOpen
+		}
+		b.probes++
+	}
+	return b.generation, nil
+}
+
+// Done 记录请求结果，generation 为 Allow 的返回值
+// 状态变化之前放行的请求（如打开前放行、在半开状态下才结束的请求）不计入结果
+// err 为 CodeCanceled 时等同于 Cancel
+func (b *Breaker) Done(generation uint64, err error) {
+	// 调用方取消的请求不能说明后端的状态，不记录结果
+	if ErrorCode(err) == CodeCanceled {
+		b.Cancel(generation)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.refresh(now)
+	if generation != b.generation {
+		return
+	}
+	failed := err != nil && b.opt.IsFailure(err)
+
+	switch b.state {
+	case StateHalfOpen:
+		if failed {
+			b.open(now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.opt.HalfOpenRequests {
+			b.reset(StateClosed, now)
+		}
+		return
+	case StateOpen:
+		return
+	}
+
+	b.requests++
+	if !failed {
+		b.consecutive = 0
+		return
+	}
+
+	b.failures++
+	b.consecutive++
+	if b.consecutive >= b.opt.ConsecutiveFailures ||
+		(b.requests >= b.opt.MinRequests && float64(b.failures)/float64(b.requests) >= b.opt.ErrorRate) {
+		b.open(now)
+	}
+}
+
+// Cancel 放弃放行的请求，不记录结果；半开状态下归还探测名额
+// 用于调用方主动取消的请求（如对冲中落后的调用），慢请求不应被当作成功
+func (b *Breaker) Cancel(generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh(time.Now())
+	if generation == b.generation && b.state == StateHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// Do 在熔断器保护下执行 f
+func (b *Breaker) Do(f func() error) error {
+	generation, err := b.Allow()
+	if err != nil {
+		return err
+	}
+	err = f()
+	b.Done(generation, err)
+	return err
+}
+
+// 根据时间推进状态（需持有锁）
+func (b *Breaker) refresh(now time.Time) {
+	switch b.state {
+	case StateClosed:
+		if now.Sub(b.windowStart) >= b.opt.Window {
+			b.reset(StateClosed, now)
+		}
+	case StateOpen:
+		if now.Sub(b.openedAt) >= b.opt.OpenTimeout {
+			b.reset(StateHalfOpen, now)
+		}
+	}
+}
+
+func (b *Breaker) open(now time.Time) {
+	b.reset(StateOpen, now)
+	b.openedAt = now
+}
+
+func (b *Breaker) reset(state BreakerState, now time.Time) {
+	if state != b.state {
+		b.generation++
+	}
+	b.state = state
+	b.windowStart = now
+	b.requests, b.failures, b.consecutive = 0, 0, 0
+	b.probes, b.successes = 0, 0
+}
+
+// BreakerGroup 按后端地址维护熔断器，供多后端的调用方使用
+type BreakerGroup struct {
+	opt      *BreakerOption
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+// NewBreakerGroup 创建熔断器组，opt 为 nil 时使用默认配置
+func NewBreakerGroup(opt *BreakerOption) *BreakerGroup {
+	return &BreakerGroup{opt: opt, breakers: make(map[string]*Breaker)}
+}
+
+// Get 返回地址对应的熔断器，不存在时创建
+func (g *BreakerGroup) Get(addr string) *Breaker {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	b := g.breakers[addr]
+	if b == nil {
+		b = NewBreaker(g.opt)
+		g.breakers[addr] = b
+	}
+	return b
+}
@@ -0,0 +1,126 @@
+package Trpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	t.Parallel()
+
+	unavailable := Errorf(CodeUnavailable, "down")
+
+	t.Run("consecutive failures", func(t *testing.T) {
+		b := NewBreaker(&BreakerOption{ConsecutiveFailures: 3, OpenTimeout: time.Millisecond * 50})
+		for i := 0; i < 3; i++ {
+			_ = b.Do(func() error { return unavailable })
+		}
+		_assert(b.State() == StateOpen, "expect open, but got %s", b.State())
+		err := b.Do(func() error { return nil })
+		_assert(err == ErrBreakerOpen && ErrorCode(err) == CodeUnavailable, "expect fail fast, but got %v", err)
+
+		// 半开状态只放行一个探测请求
+		time.Sleep(time.Millisecond * 60)
+		probe, err := b.Allow()
+		_assert(err == nil, "half-open breaker should allow a probe")
+		_, err = b.Allow()
+		_assert(err == ErrBreakerOpen, "half-open breaker should reject extra probes")
+		b.Done(probe, unavailable)
+		_assert(b.State() == StateOpen, "failed probe should reopen the breaker")
+
+		time.Sleep(time.Millisecond * 60)
+		_ = b.Do(func() error { return nil })
+		_assert(b.State() == StateClosed, "successful probe should close the breaker")
+	})
+
+	t.Run("error rate", func(t *testing.T) {
+		b := NewBreaker(&BreakerOption{ConsecutiveFailures: 100, ErrorRate: 0.5, MinRequests: 10})
+		for i := 0; i < 9; i++ {
+			err := error(nil)
+			if i%2 == 1 {
+				err = unavailable
+			}
+			_ = b.Do(func() error { return err })
+		}
+		_assert(b.State() == StateClosed, "breaker should wait for MinRequests")
+		_ = b.Do(func() error { return unavailable })
+		_assert(b.State() == StateOpen, "expect open after error rate reached")
+	})
+
+	t.Run("stale results", func(t *testing.T) {
+		b := NewBreaker(&BreakerOption{ConsecutiveFailures: 1, OpenTimeout: time.Millisecond * 50})
+		slow, _ := b.Allow()
+		_ = b.Do(func() error { return unavailable })
+		_assert(b.State() == StateOpen, "expect open, but got %s", b.State())
+
+		// 打开前放行的请求在半开状态下结束，不能作为探测请求的结果
+		time.Sleep(time.Millisecond * 60)
+		probe, err := b.Allow()
+		_assert(err == nil, "half-open breaker should allow a probe")
+		b.Done(slow, nil)
+		_assert(b.State() == StateHalfOpen, "stale success should not close the breaker, but got %s", b.State())
+		b.Done(probe, unavailable)
+		_assert(b.State() == StateOpen, "failed probe should reopen the breaker")
+
+		// 取消的探测请求不记录结果，归还名额
+		time.Sleep(time.Millisecond * 60)
+		probe, _ = b.Allow()
+		b.Cancel(probe)
+		_assert(b.State() == StateHalfOpen, "canceled probe should not change the state")
+		_, err = b.Allow()
+		_assert(err == nil, "canceled probe should be returned")
+	})
+
+	t.Run("caller canceled", func(t *testing.T) {
+		b := NewBreaker(&BreakerOption{ConsecutiveFailures: 1, OpenTimeout: time.Millisecond * 50})
+		_ = b.Do(func() error { return unavailable })
+		time.Sleep(time.Millisecond * 60)
+
+		// 调用方放弃的探测请求不能关闭熔断器
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := b.Do(func() error { return contextError("rpc client: call failed", ctx) })
+		_assert(ErrorCode(err) == CodeCanceled, "expect CodeCanceled, but got %v", err)
+		_assert(b.State() == StateHalfOpen, "canceled probe should not close the breaker, but got %s", b.State())
+		_, err = b.Allow()
+		_assert(err == nil, "canceled probe should be returned")
+	})
+
+	t.Run("handler errors", func(t *testing.T) {
+		b := NewBreaker(&BreakerOption{ConsecutiveFailures: 1})
+		_ = b.Do(func() error { return errors.New("bad args") })
+		_assert(b.State() == StateClosed, "handler errors should not trip the breaker")
+	})
+
+	t.Run("pool", func(t *testing.T) {
+		p := NewPool(&PoolOption{Breaker: &BreakerOption{ConsecutiveFailures: 2}})
+		defer func() { _ = p.Close() }()
+
+		addr := "tcp@127.0.0.1:1"
+		for i := 0; i < 2; i++ {
+			err := p.Call(context.Background(), addr, "Foo.Sum", Args{1, 2}, new(int))
+			_assert(err != nil && err != ErrBreakerOpen, "expect dial error, but got %v", err)
+		}
+		err := p.Call(context.Background(), addr, "Foo.Sum", Args{1, 2}, new(int))
+		_assert(err == ErrBreakerOpen, "expect ErrBreakerOpen, but got %v", err)
+		_assert(p.Breaker("tcp@127.0.0.1:2").State() == StateClosed, "breakers should be per address")
+	})
+
+	t.Run("pool exhausted", func(t *testing.T) {
+		l, _ := net.Listen("tcp", "127.0.0.1:0")
+		go NewServer().Accept(l)
+		p := NewPool(&PoolOption{MaxConns: 1, Breaker: &BreakerOption{ConsecutiveFailures: 1}})
+		defer func() { _ = p.Close() }()
+
+		_, err := p.Get("tcp@" + l.Addr().String())
+		_assert(err == nil, "failed to dial: %v", err)
+		// 连接总数已达上限，其他地址的调用在本地失败，不计入熔断
+		addr := "tcp@127.0.0.1:1"
+		err = p.Call(context.Background(), addr, "Foo.Sum", Args{1, 2}, new(int))
+		_assert(err == ErrPoolExhausted, "expect ErrPoolExhausted, but got %v", err)
+		_assert(p.Breaker(addr).State() == StateClosed, "pool errors should not open the breaker")
+	})
+}
@@ -0,0 +1,194 @@
+/**
+ * @Author : liangliangtoo
+ * @File : callback
+ * @Date: 2026/10/18 14:25
+ * @Description: 服务端通过同一连接回调客户端注册的方法
+ */
+package Trpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/LucienVen/Trpc/core"
+)
+
+/**
+回调与普通调用方向相反，序号相互独立：
+	server --- KindCallback      ---> client  按客户端注册的 receiver 执行方法
+	server <-- KindCallbackReply --- client  回复结果
+处理函数使用带上下文的签名，通过 CallbackFromContext 获取回调句柄：
+	func (t *T) Method(ctx context.Context, args T1, reply *T2) error
+*/
+
+/** 客户端 **/
+
+// RegisterCallback 注册可被服务端回调的 receiver，规则与 Server.Register 相同
+func (client *Client) RegisterCallback(rcvr interface{}) error {
+	if err := checkServiceName(rcvr); err != nil {
+		return err
+	}
+	svc := newService(rcvr)
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if _, dup := client.callbacks[svc.name]; dup {
+		return errors.New("rpc client: callback already defined: " + svc.name)
+	}
+	client.callbacks[svc.name] = svc
+	return nil
+}
+
+// 寻找客户端注册的回调方法
+func (client *Client) findCallback(serviceMethod string) (*service, *methodType, error) {
+	dot := strings.LastIndex(serviceMethod, ".")
+	if dot < 0 {
+		return nil, nil, Errorf(CodeNotFound, "rpc client: callback service/method ill-formed: %s", serviceMethod)
+	}
+
+	client.mu.Lock()
+	svc := client.callbacks[serviceMethod[:dot]]
+	client.mu.Unlock()
+	if svc == nil {
+		return nil, nil, Errorf(CodeNotFound, "rpc client: can't find callback service %s", serviceMethod[:dot])
+	}
+
+	mtype := svc.method[serviceMethod[dot+1:]]
+	if mtype == nil || mtype.stream {
+		return nil, nil, Errorf(CodeNotFound, "rpc client: can't find callback method %s", serviceMethod[dot+1:])
+	}
+	return svc, mtype, nil
+}
+
+// 读取服务端的回调请求，在新的 goroutine 中执行并回复
+func (client *Client) receiveCallback(h *core.Header) error {
+	reply := &core.Header{ServiceMethod: h.ServiceMethod, Seq: h.Seq, Kind: core.KindCallbackReply}
+
+	svc, mtype, err := client.findCallback(h.ServiceMethod)
+	if err != nil {
+		if rerr := client.cc.ReadBody(nil); rerr != nil {
+			return rerr
+		}
+		setHeaderError(reply, err)
+		go client.writeCallbackReply(reply, invalidRequest)
+		return nil
+	}
+
+	argv, replyv := mtype.newArgv(), mtype.newReplyv()
+	if err = client.cc.ReadBody(argvInterface(argv)); err != nil {
+		return err
+	}
+
+	go func() {
+		if err := svc.callContext(context.Background(), mtype, argv, replyv); err != nil {
+			setHeaderError(reply, err)
+			client.writeCallbackReply(reply, invalidRequest)
+			return
+		}
+		client.writeCallbackReply(reply, replyv.Interface())
+	}()
+	return nil
+}
+
+func (client *Client) writeCallbackReply(h *core.Header, body interface{}) {
+	if err := client.writeFrame(h, body); err != nil {
+		client.logger().Log(LevelWarn, "rpc client: write callback reply error", F("method", h.ServiceMethod), F("err", err))
+	}
+}
+
+/** 服务端 **/
+
+type callbackKey struct{}
+
+// Callback 服务端持有的回调句柄，对应一个客户端连接
+type Callback struct {
+	sc *serverConn
+}
+
+// CallbackFromContext 从处理函数的上下文中获取当前连接的回调句柄
+// 上下文不是来自服务端连接时返回 nil
+func CallbackFromContext(ctx context.Context) *Callback {
+	cb, _ := ctx.Value(callbackKey{}).(*Callback)
+	return cb
+}
+
+// Go 异步回调客户端的方法
+func (cb *Callback) Go(serviceMethod string, args, reply interface{}, done chan *Call) *Call {
+	if done == nil {
+		done = make(chan *Call, 10)
+	} else if cap(done) == 0 {
+		panic("rpc server: done channel is unbuffered")
+	}
+
+	call := &Call{
+		ServiceMethod: serviceMethod,
+		Args:          args,
+		Reply:         reply,
+		Done:          done,
+	}
+
+	sc := cb.sc
+	sc.mu.Lock()
+	if sc.closed {
+		sc.mu.Unlock()
+		call.Error = ErrShutdown
+		call.done()
+		return call
+	}
+	call.Seq = sc.cbSeq
+	sc.cbSeq++
+	sc.callbacks[call.Seq] = call
+	sc.mu.Unlock()
+
+	h := &core.Header{ServiceMethod: serviceMethod, Seq: call.Seq, Kind: core.KindCallback}
+	if err := sc.writeFrame(h, args); err != nil {
+		if call := sc.removeCallback(call.Seq); call != nil {
+			call.Error = err
+			call.done()
+		}
+	}
+	return call
+}
+
+// Call 回调客户端的方法并等待结果
+func (cb *Callback) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	call := cb.Go(serviceMethod, args, reply, make(chan *Call, 1))
+	select {
+	case <-ctx.Done():
+		cb.sc.removeCallback(call.Seq)
+		return contextError("rpc server: callback failed", ctx)
+	case call := <-call.Done:
+		return call.Error
+	}
+}
+
+func (sc *serverConn) removeCallback(seq uint64) *Call {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	call, ok := sc.callbacks[seq]
+	if ok {
+		delete(sc.callbacks, seq)
+	}
+	return call
+}
+
+// 读取客户端对回调的回复
+func (sc *serverConn) receiveCallbackReply(h *core.Header) error {
+	call := sc.removeCallback(h.Seq)
+	switch {
+	case call == nil:
+		return sc.cc.ReadBody(nil)
+	case h.Error != "":
+		call.Error = headerError(h)
+		call.done()
+		return sc.cc.ReadBody(nil)
+	default:
+		err := sc.cc.ReadBody(call.Reply)
+		if err != nil {
+			call.Error = errors.New("reading body " + err.Error())
+		}
+		call.done()
+		return err
+	}
+}
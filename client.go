@@ -14,7 +14,6 @@ import (
 	"fmt"
 	"github.com/LucienVen/Trpc/core"
 	"io"
-	"log"
 	"net"
 	"net/http"
 	"strings"
@@ -30,9 +29,16 @@ type Call struct {
 	Reply         interface{} // 回复
 	Error         error
 	Done          chan *Call // 调用结束后通知调用方
+	kind          core.Kind  // 请求帧类型，零值为普通调用
+	meta          map[string]string // 请求头元数据
+	target        string            // 连接的远端地址，用于统计
+	start         time.Time         // 发送时间，零值代表不统计
 }
 
 func (c *Call) done() {
+	if !c.start.IsZero() {
+		clientMetricsFor(c.target, c.ServiceMethod).observe(c.Error, time.Since(c.start))
+	}
 	c.Done <- c
 }
 
@@ -48,8 +54,15 @@ type Client struct {
 	mu       sync.Mutex
 	seq      uint64           // 每个请求唯一序号
 	pending  map[uint64]*Call // 存储未处理完的请求，map[seq]*Call
+	streams  map[uint64]*ClientStream // 活跃的流，map[seq]*ClientStream
+	callbacks map[string]*service     // 可被服务端回调的服务
+	idempotent map[string]bool        // 服务端声明为幂等的方法
 	closing  bool
 	shutdown bool
+	done     chan struct{} // receive 退出（连接不可用）后关闭
+	closeErr error         // 主动断开连接的原因，优先于读取错误通知给调用方
+	pong     chan struct{} // 收到心跳回复
+	target   string        // 连接的远端地址，用于统计
 }
 
 // TODO 这是什么写法？？
@@ -57,6 +70,8 @@ var _ io.Closer = (*Client)(nil)
 
 var ErrShutdown = errors.New("connection is shut down")
 
+var ErrKeepaliveTimeout = errors.New("rpc client: keepalive timeout")
+
 // Close 关闭连接
 func (client *Client) Close() error {
 	client.mu.Lock()
@@ -77,6 +92,14 @@ func (client *Client) IsAvailable() bool {
 	return !client.shutdown && !client.closing
 }
 
+// 未完成的请求与流的数量，用于衡量连接的负载
+func (client *Client) numPending() int {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	return len(client.pending) + len(client.streams)
+}
+
 // 将参数call 添加到client.pending中，并更新client.seq
 func (client *Client) registerCall(call *Call) (uint64, error) {
 	client.mu.Lock()
@@ -93,7 +116,7 @@ func (client *Client) registerCall(call *Call) (uint64, error) {
 }
 
 // 根据seq, 从client.pending 中移除对应的call
-func (client Client) removeCall(seq uint64) *Call {
+func (client *Client) removeCall(seq uint64) *Call {
 	client.mu.Lock()
 	defer client.mu.Unlock()
 	call, ok := client.pending[seq]
@@ -113,10 +136,56 @@ func (client *Client) terminateCalls(err error)  {
 	defer client.mu.Unlock()
 
 	client.shutdown = true
-	for _, call := range client.pending {
+	for seq, call := range client.pending {
+		delete(client.pending, seq)
 		call.Error = err
 		call.done()
 	}
+	// 流以 io.EOF 表示正常结束，连接断开时需要区分
+	streamErr := err
+	if err == io.EOF {
+		streamErr = ErrShutdown
+	}
+	for seq, cs := range client.streams {
+		delete(client.streams, seq)
+		cs.abort(streamErr)
+	}
+}
+
+// 创建流并分配流ID（与请求共用 seq）
+func (client *Client) registerStream(ctx context.Context, serviceMethod string) (*ClientStream, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if client.closing || client.shutdown {
+		return nil, ErrShutdown
+	}
+
+	cs := &ClientStream{client: client}
+	cs.stream = newStream(ctx, client.seq, serviceMethod, client.opt.CodecType, client.opt.StreamWindow, client.writeFrame)
+	client.streams[client.seq] = cs
+	client.seq++
+	return cs, nil
+}
+
+// 根据流ID移除流
+func (client *Client) removeStream(seq uint64) *ClientStream {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	cs, ok := client.streams[seq]
+	if ok {
+		delete(client.streams, seq)
+	}
+
+	return cs
+}
+
+// 在发送锁下写出一帧（流消息使用）
+func (client *Client) writeFrame(h *core.Header, body interface{}) error {
+	client.sending.Lock()
+	defer client.sending.Unlock()
+
+	return client.cc.Write(h, body)
 }
 
 /** 请求与响应 **/
@@ -131,13 +200,36 @@ func (client *Client) receive()  {
 			break
 		}
 
+		if h.Kind.IsStream() {
+			err = client.receiveStream(&h)
+			continue
+		}
+
+		if h.Kind == core.KindCallback {
+			err = client.receiveCallback(&h)
+			continue
+		}
+
+		if h.Kind == core.KindPong {
+			select {
+			case client.pong <- struct{}{}:
+			default:
+			}
+			err = client.cc.ReadBody(nil)
+			continue
+		}
+
+		if h.Meta[MetaIdempotent] != "" {
+			client.markIdempotent(h.ServiceMethod)
+		}
+
 		call := client.removeCall(h.Seq)
 		switch {
 		case call == nil:
 			// 通常表示写入部分失败，并且调用已被删除
 			err = client.cc.ReadBody(nil)
 		case h.Error != "":
-			call.Error = fmt.Errorf(h.Error)
+			call.Error = headerError(&h)
 			err = client.cc.ReadBody(nil)
 			call.done()
 		default:
@@ -148,6 +240,102 @@ func (client *Client) receive()  {
 			call.done()
 		}
 	}
+
+	// 连接出错，通知所有未完成的请求和流
+	client.mu.Lock()
+	if client.closeErr != nil {
+		err = client.closeErr
+	}
+	client.mu.Unlock()
+	client.terminateCalls(err)
+	close(client.done)
+}
+
+// 定期发送心跳，超时未收到回复时认为连接已断开
+func (client *Client) keepalive(interval, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = interval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-client.done:
+			return
+		}
+
+		// 连接半断开时写操作可能阻塞，不能影响超时判断
+		go func() {
+			if err := client.writeFrame(&core.Header{Kind: core.KindPing}, invalidRequest); err != nil {
+				client.logger().Log(LevelWarn, "rpc client: send ping error", F("err", err))
+			}
+		}()
+
+		timer := time.NewTimer(timeout)
+		select {
+		case <-client.pong:
+			timer.Stop()
+		case <-client.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+			// 关闭连接使 receive 退出，由其以超时错误结束所有调用
+			client.mu.Lock()
+			client.closeErr = ErrKeepaliveTimeout
+			client.mu.Unlock()
+			_ = client.cc.Close()
+			return
+		}
+	}
+}
+
+// 处理流相关的帧
+func (client *Client) receiveStream(h *core.Header) error {
+	client.mu.Lock()
+	cs := client.streams[h.Seq]
+	client.mu.Unlock()
+	if cs == nil {
+		// 流已经结束或被取消
+		return client.cc.ReadBody(nil)
+	}
+
+	switch h.Kind {
+	case core.KindStreamData:
+		var data []byte
+		if err := client.cc.ReadBody(&data); err != nil {
+			return err
+		}
+		if !cs.deliver(data) {
+			client.removeStream(h.Seq)
+			cs.overflow()
+		}
+	case core.KindStreamWindow:
+		var n uint32
+		if err := client.cc.ReadBody(&n); err != nil {
+			return err
+		}
+		cs.addCredit(n)
+	case core.KindStreamClose:
+		// 服务端的处理函数已返回
+		client.removeStream(h.Seq)
+		if h.Error != "" {
+			cs.closeRecv(headerError(h))
+		} else {
+			cs.closeRecv(io.EOF)
+		}
+		cs.abort(ErrStreamClosed)
+		return client.cc.ReadBody(nil)
+	case core.KindStreamReset:
+		client.removeStream(h.Seq)
+		cs.abort(errStreamReset)
+		return client.cc.ReadBody(nil)
+	default:
+		return client.cc.ReadBody(nil)
+	}
+
+	return nil
 }
 
 // NewClient 创建client实例
@@ -156,18 +344,22 @@ func NewClient(conn net.Conn, opt *Option) (*Client, error) {
 	f := core.NewCodecFuncMap[opt.CodecType]
 	if f == nil {
 		err := fmt.Errorf("invalid core type: %s", opt.CodecType)
-		log.Println("rpc client: core error:", err)
+		optionLogger(opt).Log(LevelError, "rpc client: codec error", F("err", err))
 		return nil, err
 	}
 
 	// 使用服务器发送选项
 	if err := json.NewEncoder(conn).Encode(opt); err != nil {
-		log.Println("rpc clientL options error: ", err)
+		optionLogger(opt).Log(LevelError, "rpc client: options error", F("err", err))
 		_ = conn.Close()
 		return nil, err
 	}
 	
-	return newClientCodec(f(conn), opt), nil
+	client := newClientCodec(f(conn), opt)
+	if conn.RemoteAddr() != nil {
+		client.target = conn.RemoteAddr().String()
+	}
+	return client, nil
 }
 
 // 建立实例，接收请求
@@ -177,9 +369,17 @@ func newClientCodec(cc core.Codec, opt *Option) *Client {
 		opt:      opt,
 		seq:      1, // 序号从1开始
 		pending:  make(map[uint64]*Call),
+		streams:  make(map[uint64]*ClientStream),
+		callbacks: make(map[string]*service),
+		idempotent: make(map[string]bool),
+		done:     make(chan struct{}),
+		pong:     make(chan struct{}, 1),
 	}
 
 	go client.receive()
+	if opt.KeepaliveInterval > 0 {
+		go client.keepalive(opt.KeepaliveInterval, opt.KeepaliveTimeout)
+	}
 	return client
 }
 
@@ -229,6 +429,7 @@ func (client *Client) send(call *Call)  {
 	defer client.sending.Unlock()
 
 	// 注册结构体call
+	call.target, call.start = client.target, time.Now()
 	seq, err := client.registerCall(call)
 	if err != nil {
 		call.Error = err
@@ -240,6 +441,9 @@ func (client *Client) send(call *Call)  {
 	client.header.ServiceMethod = call.ServiceMethod
 	client.header.Seq = seq
 	client.header.Error = ""
+	client.header.Code = 0
+	client.header.Kind = call.kind
+	client.header.Meta = call.meta
 
 	// 编码且发送请求
 	if err := client.cc.Write(&client.header, call.Args); err != nil {
@@ -253,11 +457,18 @@ func (client *Client) send(call *Call)  {
 }
 
 // Go 函数 异步调用，发起请求
+// 不携带优先级与 trace 上下文，需要时使用 GoContext
 func (client *Client) Go(serviceMethod string, args, reply interface{}, done chan *Call) *Call {
+	return client.GoContext(context.Background(), serviceMethod, args, reply, done)
+}
+
+// GoContext 异步调用，请求头携带 ctx 中的优先级与 trace 上下文
+// ctx 只用于元数据，取消 ctx 不会取消调用；不会创建客户端 span
+func (client *Client) GoContext(ctx context.Context, serviceMethod string, args, reply interface{}, done chan *Call) *Call {
 	if done == nil {
 		done = make(chan *Call, 10)
 	} else if cap(done) == 0 {
-		log.Panic("rpc client: done channel is unbuffered")
+		panic("rpc client: done channel is unbuffered")
 	}
 
 	call := &Call{
@@ -265,20 +476,76 @@ func (client *Client) Go(serviceMethod string, args, reply interface{}, done cha
 		Args:          args,
 		Reply:         reply,
 		Done:          done,
+		meta:          injectSpan(ctx, priorityMeta(ctx)),
 	}
 
 	client.send(call)
 	return call
 }
 
+// Notify 单向调用，不等待服务端响应，也不在 pending 中登记
+// 返回的错误仅表示请求是否成功写出；不携带优先级与 trace 上下文，需要时使用 NotifyContext
+func (client *Client) Notify(serviceMethod string, args interface{}) error {
+	return client.NotifyContext(context.Background(), serviceMethod, args)
+}
+
+// NotifyContext 单向调用，请求头携带 ctx 中的优先级与 trace 上下文
+func (client *Client) NotifyContext(ctx context.Context, serviceMethod string, args interface{}) error {
+	if !client.IsAvailable() {
+		return ErrShutdown
+	}
+
+	client.sending.Lock()
+	defer client.sending.Unlock()
+
+	// seq 从1开始，单向调用固定使用0，不会与其他请求冲突
+	h := &core.Header{
+		ServiceMethod: serviceMethod,
+		Kind:          core.KindNotify,
+		Meta:          injectSpan(ctx, priorityMeta(ctx)),
+	}
+	return client.cc.Write(h, args)
+}
+
 // Call 对Go函数的封装，阻塞等待call.Done, 等待响应返回
 // 返回错误状态
+// 配置了 Option.Retry 时按策略重试幂等方法
+// Client 不会重连，连接断开后不再重试；需要在断开后重试时使用 ReconnectingClient
 func (client *Client) Call(ctx context.Context, serviceMethod string, args, relpy interface{}) error {
-	call := client.Go(serviceMethod, args, relpy, make(chan *Call, 1))
+	if client.opt.Retry == nil {
+		return client.call(ctx, serviceMethod, args, relpy)
+	}
+
+	return client.opt.Retry.do(ctx, serviceMethod, client.IsIdempotent, func() error {
+		err := client.call(ctx, serviceMethod, args, relpy)
+		if err != nil && !client.IsAvailable() {
+			// 之后的每次重试都只会得到 ErrShutdown
+			return &finalError{err}
+		}
+		return err
+	})
+}
+
+// 单次调用
+func (client *Client) call(ctx context.Context, serviceMethod string, args, relpy interface{}) (err error) {
+	ctx, span := client.opt.Tracer.start(ctx, serviceMethod, "client", client.target)
+	defer func() { span.end(err) }()
+
+	call := &Call{
+		ServiceMethod: serviceMethod,
+		Args:          args,
+		Reply:         relpy,
+		Done:          make(chan *Call, 1),
+		meta:          injectSpan(ctx, priorityMeta(ctx)),
+	}
+	client.send(call)
 	select {
 	case <-ctx.Done():
-		client.removeCall(call.Seq)
-		return errors.New("rpc client: call failed: " + ctx.Err().Error())
+		err := contextError("rpc client: call failed", ctx)
+		if call := client.removeCall(call.Seq); call != nil {
+			clientMetricsFor(call.target, call.ServiceMethod).observe(err, time.Since(call.start))
+		}
+		return err
 	case call:= <-call.Done:
 		return call.Error
 	}
@@ -362,8 +629,6 @@ func DialHTTP(network, address string, opts ...*Option) (*Client, error) {
 func XDial(rpcAddr string, opts ...*Option) (*Client, error) {
 	// 判断连接地址
 	parts := strings.Split(rpcAddr, "@")
-
-	fmt.Println("[LOG]parts", parts)
 	if len(parts) != 2 {
 		return nil, fmt.Errorf("rpc client err: wrong format '%s', expect protocol@addr", rpcAddr)
 	}
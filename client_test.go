@@ -2,10 +2,12 @@ package Trpc
 
 import (
 	"context"
+	"io"
 	"net"
 	"os"
 	"runtime"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -59,7 +61,8 @@ func TestClient_Call(t *testing.T) {
 	time.Sleep(time.Second)
 	t.Run("client timeout", func(t *testing.T) {
 		client, _ := Dial("tcp", addr)
-		ctx, _ := context.WithTimeout(context.Background(), time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
 		var reply int
 		err := client.Call(ctx, "Bar.Timeout", 1, &reply)
 		_assert(err != nil && strings.Contains(err.Error(), ctx.Err().Error()), "expect a timeout error")
@@ -86,7 +89,8 @@ func TestXDial(t *testing.T) {
 			_ = os.Remove(addr)
 			l, err := net.Listen("unix", addr)
 			if err != nil {
-				t.Fatal("failed to listen unix socket")
+				t.Error("failed to listen unix socket")
+				return
 			}
 
 			ch <- struct{}{}
@@ -98,4 +102,457 @@ func TestXDial(t *testing.T) {
 		_, err := XDial("unix@" + addr)
 		_assert(err == nil, "failed to connect unix socket")
 	}
-}
\ No newline at end of file
+}
+
+// 测试单向调用
+type Event chan string
+
+func (e Event) Emit(msg string, reply *int) error {
+	e <- msg
+	return nil
+}
+
+func TestClient_Notify(t *testing.T) {
+	t.Parallel()
+
+	events := make(Event, 1)
+	server := NewServer()
+	_ = server.Register(events)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+
+	client, _ := Dial("tcp", l.Addr().String())
+	defer func() { _ = client.Close() }()
+
+	err := client.Notify("Event.Emit", "hello")
+	_assert(err == nil, "failed to notify: %v", err)
+	select {
+	case msg := <-events:
+		_assert(msg == "hello", "expect hello, but got %s", msg)
+	case <-time.After(time.Second):
+		t.Fatal("notify is not delivered")
+	}
+
+	// 未知方法也不会有响应，且不影响后续调用
+	_ = client.Notify("Event.Nope", "hello")
+	client.mu.Lock()
+	_assert(len(client.pending) == 0, "notify should not register pending calls")
+	client.mu.Unlock()
+
+	var reply int
+	err = client.Call(context.Background(), "Event.Emit", "world", &reply)
+	_assert(err == nil && <-events == "world", "failed to call after notify: %v", err)
+}
+
+// 测试批量调用
+func TestClient_Batch(t *testing.T) {
+	t.Parallel()
+
+	server := NewServer()
+	var foo Foo
+	_ = server.Register(&foo)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+
+	client, _ := Dial("tcp", l.Addr().String())
+	defer func() { _ = client.Close() }()
+
+	replies := make([]int, 50)
+	items := make([]BatchItem, 0, 51)
+	for i := range replies {
+		items = append(items, BatchItem{ServiceMethod: "Foo.Sum", Args: Args{Num1: i, Num2: i}, Reply: &replies[i]})
+	}
+	items = append(items, BatchItem{ServiceMethod: "Foo.Nope", Args: Args{}, Reply: new(int)})
+
+	err := client.Batch(context.Background(), items)
+	_assert(err == nil, "failed to batch: %v", err)
+	for i := range replies {
+		_assert(items[i].Error == nil && replies[i] == 2*i, "wrong reply %d for item %d", replies[i], i)
+	}
+	_assert(items[50].Error != nil && strings.Contains(items[50].Error.Error(), "can't find method"),
+		"expect a method error for item 50")
+}
+
+// 批量中的每个请求同样受处理超时限制
+func TestClient_BatchTimeout(t *testing.T) {
+	t.Parallel()
+
+	gate := make(Gate)
+	defer close(gate)
+	var foo Foo
+	server := NewServer()
+	_ = server.Register(gate)
+	_ = server.Register(&foo)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+
+	client, _ := Dial("tcp", l.Addr().String(), &Option{HandleTimeout: time.Millisecond * 50})
+	defer func() { _ = client.Close() }()
+
+	var sum int
+	items := []BatchItem{
+		{ServiceMethod: "Gate.Wait", Args: 1, Reply: new(int)},
+		{ServiceMethod: "Foo.Sum", Args: Args{Num1: 1, Num2: 2}, Reply: &sum},
+	}
+	err := client.Batch(context.Background(), items)
+	_assert(err == nil, "failed to batch: %v", err)
+	_assert(ErrorCode(items[0].Error) == CodeDeadlineExceeded, "expect CodeDeadlineExceeded, but got %v", items[0].Error)
+	_assert(items[1].Error == nil && sum == 3, "wrong reply %d (%v)", sum, items[1].Error)
+}
+
+// 测试服务端回调
+type Job int
+
+func (j Job) Run(ctx context.Context, steps int, reply *int) error {
+	cb := CallbackFromContext(ctx)
+	for i := 1; i <= steps; i++ {
+		var ack bool
+		if err := cb.Call(ctx, "Progress.Update", i, &ack); err != nil {
+			return err
+		}
+	}
+	*reply = steps
+	return nil
+}
+
+type Progress chan int
+
+func (p Progress) Update(step int, ack *bool) error {
+	p <- step
+	*ack = true
+	return nil
+}
+
+func TestClient_RegisterCallback(t *testing.T) {
+	t.Parallel()
+
+	server := NewServer()
+	var job Job
+	_ = server.Register(&job)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+
+	client, _ := Dial("tcp", l.Addr().String())
+	defer func() { _ = client.Close() }()
+
+	progress := make(Progress, 3)
+	_assert(client.RegisterCallback(progress) == nil, "failed to register callback")
+	_assert(client.RegisterCallback(progress) != nil, "expect a duplicate callback error")
+
+	var reply int
+	err := client.Call(context.Background(), "Job.Run", 3, &reply)
+	_assert(err == nil && reply == 3, "failed to call Job.Run: %v", err)
+	_assert(<-progress == 1 && <-progress == 2 && <-progress == 3, "wrong progress")
+}
+
+// 测试心跳与空闲连接
+func TestClient_keepalive(t *testing.T) {
+	t.Parallel()
+
+	t.Run("missed pong", func(t *testing.T) {
+		// 只读取、从不回复的服务端
+		l, _ := net.Listen("tcp", "127.0.0.1:0")
+		go func() {
+			conn, err := l.Accept()
+			if err == nil {
+				_, _ = io.Copy(io.Discard, conn)
+			}
+		}()
+
+		client, _ := Dial("tcp", l.Addr().String(), &Option{
+			KeepaliveInterval: 50 * time.Millisecond,
+			KeepaliveTimeout:  50 * time.Millisecond,
+		})
+		var reply int
+		err := client.Call(context.Background(), "Foo.Sum", Args{}, &reply)
+		_assert(err == ErrKeepaliveTimeout, "expect a keepalive timeout, but got %v", err)
+		_assert(!client.IsAvailable(), "client should not be available")
+	})
+
+	server := NewServer()
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+
+	t.Run("idle timeout", func(t *testing.T) {
+		client, _ := Dial("tcp", l.Addr().String(), &Option{IdleTimeout: 50 * time.Millisecond})
+		time.Sleep(300 * time.Millisecond)
+		_assert(!client.IsAvailable(), "idle connection should be closed by server")
+	})
+
+	t.Run("server idle timeout", func(t *testing.T) {
+		strict := NewServer()
+		strict.IdleTimeout = 50 * time.Millisecond
+		sl, _ := net.Listen("tcp", "127.0.0.1:0")
+		go strict.Accept(sl)
+
+		// 客户端不设置或设置更长的空闲超时，都不能阻止服务端回收
+		for _, opt := range []*Option{{}, {IdleTimeout: time.Hour}} {
+			client, _ := Dial("tcp", sl.Addr().String(), opt)
+			time.Sleep(300 * time.Millisecond)
+			_assert(!client.IsAvailable(), "server idle timeout should apply to %+v", opt)
+		}
+		_assert(idleTimeout(time.Second, 0) == time.Second && idleTimeout(0, time.Second) == time.Second &&
+			idleTimeout(time.Second, time.Minute) == time.Second && idleTimeout(0, 0) == 0, "unexpected idle timeout")
+	})
+
+	t.Run("pings keep connection", func(t *testing.T) {
+		client, _ := Dial("tcp", l.Addr().String(), &Option{
+			IdleTimeout:       100 * time.Millisecond,
+			KeepaliveInterval: 20 * time.Millisecond,
+		})
+		defer func() { _ = client.Close() }()
+		time.Sleep(300 * time.Millisecond)
+		_assert(client.IsAvailable(), "connection with heartbeats should stay open")
+	})
+}
+
+// 测试自动重连
+func TestReconnectingClient(t *testing.T) {
+	t.Parallel()
+
+	server := NewServer()
+	var foo Foo
+	_ = server.Register(&foo)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	conns := make(chan net.Conn, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+			go server.ServeConn(conn)
+		}
+	}()
+
+	rc, err := NewReconnectingClient("tcp@"+l.Addr().String(), &ReconnectOption{MinBackoff: 10 * time.Millisecond})
+	_assert(err == nil, "failed to dial: %v", err)
+	defer func() { _ = rc.Close() }()
+
+	// 服务端断开连接后，调用等待重连完成
+	rc.mu.Lock()
+	old := rc.client
+	rc.mu.Unlock()
+	_ = (<-conns).Close()
+	<-old.done
+	var reply int
+	err = rc.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "failed to call after reconnect: %v", err)
+
+	// 无法重连时，FailFast 立即失败
+	ff, err := NewReconnectingClient("tcp@"+l.Addr().String(), &ReconnectOption{MinBackoff: 10 * time.Millisecond, FailFast: true})
+	_assert(err == nil, "failed to dial: %v", err)
+	defer func() { _ = ff.Close() }()
+	<-conns // rc 重连后的连接
+	_ = l.Close()
+	ff.mu.Lock()
+	old = ff.client
+	ff.mu.Unlock()
+	_ = (<-conns).Close()
+	<-old.done
+	err = ff.Call(context.Background(), "Foo.Sum", Args{}, &reply)
+	_assert(err == ErrReconnecting, "expect ErrReconnecting, but got %v", err)
+}
+
+// 测试连接池
+type Gate chan struct{}
+
+func (g Gate) Wait(args int, reply *int) error {
+	<-g
+	return nil
+}
+
+func TestPool(t *testing.T) {
+	t.Parallel()
+
+	gate := make(Gate)
+	defer close(gate)
+	server := NewServer()
+	_ = server.Register(gate)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+	addr := "tcp@" + l.Addr().String()
+
+	t.Run("least loaded", func(t *testing.T) {
+		p := NewPool(&PoolOption{ConnsPerAddr: 2})
+		defer func() { _ = p.Close() }()
+
+		c1, err := p.Get(addr)
+		_assert(err == nil, "failed to get client: %v", err)
+		c1.Go("Gate.Wait", 1, new(int), nil)
+		c2, _ := p.Get(addr)
+		_assert(c2 != c1, "busy client should not be picked while the pool can grow")
+		c2.Go("Gate.Wait", 1, new(int), nil)
+		c2.Go("Gate.Wait", 1, new(int), nil)
+		c3, _ := p.Get(addr)
+		_assert(c3 == c1, "expect the least loaded client when the pool is full")
+
+		// 不可用的连接被移除
+		_ = c1.Close()
+		<-c1.done
+		c4, _ := p.Get(addr)
+		_assert(c4 != c1 && c4 != c2 && p.total == 2, "closed client should be evicted")
+	})
+
+	t.Run("max conns", func(t *testing.T) {
+		p := NewPool(&PoolOption{ConnsPerAddr: 4, MaxConns: 1})
+		defer func() { _ = p.Close() }()
+
+		c1, _ := p.Get(addr)
+		c1.Go("Gate.Wait", 1, new(int), nil)
+		c2, _ := p.Get(addr)
+		_assert(c1 == c2 && p.total == 1, "total connections should be capped")
+		_, err := p.Get("tcp@127.0.0.1:1")
+		_assert(err == ErrPoolExhausted, "expect ErrPoolExhausted, but got %v", err)
+
+		// 其他地址上断开的连接不再占用总数
+		_ = c1.Close()
+		<-c1.done
+		_, err = p.Get("tcp@127.0.0.1:1")
+		_assert(err != ErrPoolExhausted, "closed client on another address should be evicted")
+	})
+
+	t.Run("concurrent dials", func(t *testing.T) {
+		p := NewPool(&PoolOption{ConnsPerAddr: 2})
+		defer func() { _ = p.Close() }()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if client, err := p.Get(addr); err == nil {
+					client.Go("Gate.Wait", 1, new(int), nil)
+				}
+			}()
+		}
+		wg.Wait()
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		_assert(len(p.clients[addr]) <= 2, "expect at most 2 connections, but got %d", len(p.clients[addr]))
+	})
+}
+
+// 测试重试与错误码
+type Flaky struct {
+	mu    sync.Mutex
+	fails map[string]int // 每个方法剩余的失败次数
+}
+
+func (f *Flaky) fail(method string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fails[method] > 0 {
+		f.fails[method]--
+		return Errorf(CodeUnavailable, "flaky: %s unavailable", method)
+	}
+	return nil
+}
+
+func (f *Flaky) Get(args int, reply *int) error {
+	*reply = args
+	return f.fail("Get")
+}
+
+func (f *Flaky) Put(args int, reply *int) error {
+	*reply = args
+	return f.fail("Put")
+}
+
+func TestClient_Retry(t *testing.T) {
+	t.Parallel()
+
+	flaky := &Flaky{fails: map[string]int{"Get": 2, "Put": 2}}
+	server := NewServer()
+	err := server.Register(flaky, &RegisterOption{Idempotent: []string{"Get"}})
+	_assert(err == nil, "failed to register: %v", err)
+	_assert(NewServer().Register(flaky, &RegisterOption{Idempotent: []string{"Nope"}}) != nil,
+		"expect an error for unknown idempotent method")
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+
+	policy := &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	client, _ := Dial("tcp", l.Addr().String(), &Option{Retry: policy})
+	defer func() { _ = client.Close() }()
+
+	var reply int
+	err = client.Call(context.Background(), "Flaky.Get", 1, &reply)
+	_assert(err == nil && reply == 1, "idempotent method should be retried: %v", err)
+	_assert(client.IsIdempotent("Flaky.Get"), "server should advertise Flaky.Get as idempotent")
+
+	err = client.Call(context.Background(), "Flaky.Put", 1, &reply)
+	_assert(ErrorCode(err) == CodeUnavailable, "non-idempotent method should not be retried: %v", err)
+
+	policy.Idempotent = []string{"Flaky.Put"}
+	err = client.Call(context.Background(), "Flaky.Put", 2, &reply)
+	_assert(err == nil && reply == 2, "method marked by caller should be retried: %v", err)
+
+	err = client.Call(context.Background(), "Flaky.Nope", 1, &reply)
+	_assert(ErrorCode(err) == CodeNotFound, "expect CodeNotFound, but got %v", ErrorCode(err))
+
+	// 连接断开后 Client 不会重连，不再重试
+	closed, _ := Dial("tcp", l.Addr().String(), &Option{Retry: &RetryPolicy{InitialBackoff: time.Second}})
+	_ = closed.Close()
+	begin := time.Now()
+	err = closed.Call(context.Background(), "Flaky.Get", 1, &reply)
+	_assert(err == ErrShutdown && time.Since(begin) < 500*time.Millisecond, "closed client should not retry: %v", err)
+}
+
+type Lookup struct {
+	name  string
+	delay time.Duration
+}
+
+func (l *Lookup) Get(args int, reply *string) error {
+	time.Sleep(l.delay)
+	*reply = l.name
+	return nil
+}
+
+func (l *Lookup) Put(args int, reply *string) error {
+	return l.Get(args, reply)
+}
+
+func TestPool_HedgedCall(t *testing.T) {
+	t.Parallel()
+
+	start := func(l *Lookup) string {
+		server := NewServer()
+		_ = server.Register(l, &RegisterOption{Idempotent: []string{"Get"}})
+		lis, _ := net.Listen("tcp", "127.0.0.1:0")
+		go server.Accept(lis)
+		return "tcp@" + lis.Addr().String()
+	}
+	slow := start(&Lookup{name: "slow", delay: time.Millisecond * 500})
+	fast := start(&Lookup{name: "fast"})
+
+	p := NewPool(&PoolOption{Hedge: &HedgeOption{MinDelay: time.Millisecond * 20}})
+	defer func() { _ = p.Close() }()
+	addrs := []string{slow, fast}
+	ctx := context.Background()
+
+	// 第一次调用后客户端才知道方法是幂等的
+	var reply string
+	_ = p.Call(ctx, slow, "Lookup.Get", 1, &reply)
+
+	begin := time.Now()
+	err := p.HedgedCall(ctx, addrs, "Lookup.Get", 1, &reply)
+	_assert(err == nil && reply == "fast", "expect the hedged reply, but got %q: %v", reply, err)
+	_assert(time.Since(begin) < time.Millisecond*300, "hedged call should not wait for the slow backend")
+
+	// 被取消的慢调用同样计入延迟样本，至少为对冲前的等待时间
+	p.hedges.mu.Lock()
+	samples := append([]time.Duration(nil), p.hedges.methods["Lookup.Get"].samples...)
+	p.hedges.mu.Unlock()
+	_assert(len(samples) == 2, "expect winner and loser samples, but got %v", samples)
+	_assert(samples[0] >= time.Millisecond*20 || samples[1] >= time.Millisecond*20,
+		"canceled call should be recorded as a lower bound: %v", samples)
+
+	err = p.HedgedCall(ctx, addrs, "Lookup.Get", 1, nil)
+	_assert(ErrorCode(err) == CodeInvalidArgument, "nil reply should be rejected, but got %v", err)
+
+	reply = ""
+	err = p.HedgedCall(ctx, addrs, "Lookup.Put", 1, &reply)
+	_assert(err == nil && reply == "slow", "non-idempotent method should not be hedged, but got %q", reply)
+}
@@ -0,0 +1,213 @@
+/**
+ * @Author : liangliangtoo
+ * @File : main
+ * @Date: 2026/10/19 04:10
+ * @Description: 回放 Trpc.Recorder 录制的请求，并与录制时的响应比较
+ */
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/LucienVen/Trpc"
+	"github.com/LucienVen/Trpc/core"
+)
+
+/**
+使用方式：
+	trpcreplay -addr tcp@canary:9999 -file traffic.jsonl -rate 100 -concurrency 8
+目标服务需要支持 JSON 编解码；响应与录制时的错误码或内容不一致时输出一行差异，存在差异时退出码为1
+*/
+
+type config struct {
+	addr        string
+	file        string
+	rate        float64       // 每秒发起的请求数，0代表不限制
+	concurrency int           // 同时进行的请求数
+	timeout     time.Duration // 单个请求的超时时间
+	compare     bool          // 与录制时的响应比较，否则只报告失败的请求
+}
+
+// -rate 的上限，超过后发送间隔不足1纳秒
+const maxRate = 1e9
+
+// 检查命令行参数
+func (cfg config) validate() error {
+	if cfg.addr == "" {
+		return errors.New("-addr is required")
+	}
+	// 同时排除 NaN
+	if !(cfg.rate >= 0 && cfg.rate <= maxRate) {
+		return fmt.Errorf("-rate must be between 0 and %g, got %v", float64(maxRate), cfg.rate)
+	}
+	return nil
+}
+
+// 回放结果
+type summary struct {
+	total      int
+	matched    int
+	mismatched int // 与录制时不一致（不比较时为失败）的请求数
+	elapsed    time.Duration
+}
+
+func main() {
+	var cfg config
+	flag.StringVar(&cfg.addr, "addr", "", "target address, e.g. tcp@127.0.0.1:9999, http@host:port, unix@/tmp/trpc.sock")
+	flag.StringVar(&cfg.file, "file", "traffic.jsonl", "recorded requests written by Trpc.Recorder")
+	flag.Float64Var(&cfg.rate, "rate", 0, "requests per second, 0 means unlimited")
+	flag.IntVar(&cfg.concurrency, "concurrency", 1, "number of concurrent requests")
+	flag.DurationVar(&cfg.timeout, "timeout", 5*time.Second, "timeout of each request")
+	flag.BoolVar(&cfg.compare, "compare", true, "compare replies with the recorded ones")
+	flag.Parse()
+
+	if err := cfg.validate(); err != nil {
+		fmt.Fprintln(os.Stderr, "trpcreplay:", err)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(cfg.file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "trpcreplay:", err)
+		os.Exit(1)
+	}
+	defer func() { _ = f.Close() }()
+
+	sum, err := replay(cfg, f, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "trpcreplay:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("replayed %d requests in %s: %d matched, %d mismatched\n", sum.total, sum.elapsed, sum.matched, sum.mismatched)
+	if sum.mismatched > 0 {
+		os.Exit(1)
+	}
+}
+
+// 读取录制的请求并回放，差异写入 out
+func replay(cfg config, in io.Reader, out io.Writer) (summary, error) {
+	if cfg.concurrency <= 0 {
+		cfg.concurrency = 1
+	}
+
+	client, err := Trpc.XDial(cfg.addr, &Trpc.Option{CodecType: core.JosnType})
+	if err != nil {
+		return summary{}, err
+	}
+	defer func() { _ = client.Close() }()
+
+	var (
+		sum   summary
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		calls = make(chan *Trpc.RecordedCall)
+	)
+	start := time.Now()
+	for i := 0; i < cfg.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rc := range calls {
+				diff := replayCall(client, rc, cfg)
+
+				mu.Lock()
+				sum.total++
+				if diff == "" {
+					sum.matched++
+				} else {
+					sum.mismatched++
+					_, _ = fmt.Fprintf(out, "%s: %s\n", rc.ServiceMethod, diff)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var tick <-chan time.Time
+	if cfg.rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / cfg.rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		rc := new(Trpc.RecordedCall)
+		if err = json.Unmarshal(scanner.Bytes(), rc); err != nil {
+			err = fmt.Errorf("line %d: %v", line, err)
+			break
+		}
+		if tick != nil {
+			<-tick
+		}
+		calls <- rc
+	}
+	close(calls)
+	wg.Wait()
+	sum.elapsed = time.Since(start)
+
+	if err == nil {
+		err = scanner.Err()
+	}
+	return sum, err
+}
+
+// 发起一个录制的请求，返回与录制结果的差异，一致时为空
+func replayCall(client *Trpc.Client, rc *Trpc.RecordedCall, cfg config) string {
+	ctx := rc.Context(context.Background())
+	if rc.Notify {
+		if err := client.NotifyContext(ctx, rc.ServiceMethod, rc.Args); err != nil {
+			return fmt.Sprintf("notify failed: %v", err)
+		}
+		return ""
+	}
+
+	if cfg.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.timeout)
+		defer cancel()
+	}
+
+	var reply json.RawMessage
+	err := client.Call(ctx, rc.ServiceMethod, rc.Args, &reply)
+	if !cfg.compare {
+		// 不比较时只报告失败的请求
+		if err != nil {
+			return fmt.Sprintf("call failed: %v", err)
+		}
+		return ""
+	}
+	if code := Trpc.ErrorCode(err).String(); code != rc.Code {
+		return fmt.Sprintf("code %s, recorded %s (err: %v)", code, rc.Code, err)
+	}
+	if err != nil || sameJSON(reply, rc.Reply) {
+		return ""
+	}
+	return fmt.Sprintf("reply %s, recorded %s", reply, rc.Reply)
+}
+
+// 按 JSON 值比较，忽略字段顺序与空白
+func sameJSON(a, b json.RawMessage) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return string(a) == string(b)
+	}
+	return reflect.DeepEqual(va, vb)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/LucienVen/Trpc"
+)
+
+type Calc int
+
+type Args struct {
+	Num1, Num2 int
+}
+
+func (c Calc) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+// 并发安全的 bytes.Buffer
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func startServer(recorder *Trpc.Recorder) string {
+	server := Trpc.NewServer()
+	server.Recorder = recorder
+	var calc Calc
+	_ = server.Register(&calc)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+	return l.Addr().String()
+}
+
+func TestReplay(t *testing.T) {
+	var buf syncBuffer
+	addr := startServer(Trpc.NewRecorder(&buf, nil))
+
+	// 录制时使用默认的 gob 客户端
+	client, _ := Trpc.Dial("tcp", addr)
+	var reply int
+	for i := 0; i < 3; i++ {
+		_ = client.Call(context.Background(), "Calc.Sum", Args{Num1: i, Num2: i}, &reply)
+	}
+	_ = client.Close()
+	recorded := buf.String()
+
+	cfg := config{addr: "tcp@" + startServer(nil), rate: 1000, concurrency: 2, compare: true}
+	var out bytes.Buffer
+	sum, err := replay(cfg, strings.NewReader(recorded), &out)
+	if err != nil || sum.total != 3 || sum.mismatched != 0 {
+		t.Fatalf("replay: %+v %v\n%s", sum, err, out.String())
+	}
+
+	// 修改录制的响应后应当报告差异
+	tampered := strings.Replace(recorded, `"reply":4`, `"reply":5`, 1)
+	out.Reset()
+	sum, err = replay(cfg, strings.NewReader(tampered), &out)
+	if err != nil || sum.mismatched != 1 || !strings.Contains(out.String(), "reply 4, recorded 5") {
+		t.Fatalf("expect one mismatch: %+v %v\n%s", sum, err, out.String())
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	for _, rate := range []float64{0, 0.5, 100, maxRate} {
+		cfg := config{addr: "tcp@127.0.0.1:9999", rate: rate}
+		if err := cfg.validate(); err != nil {
+			t.Fatalf("rate %v: unexpected error %v", rate, err)
+		}
+	}
+	for _, rate := range []float64{-1, maxRate * 2, math.NaN()} {
+		cfg := config{addr: "tcp@127.0.0.1:9999", rate: rate}
+		if err := cfg.validate(); err == nil {
+			t.Fatalf("rate %v: expect an error", rate)
+		}
+	}
+	if err := (config{}).validate(); err == nil {
+		t.Fatal("expect an error without -addr")
+	}
+}
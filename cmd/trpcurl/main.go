@@ -0,0 +1,203 @@
+/**
+ * @Author : liangliangtoo
+ * @File : main
+ * @Date: 2026/10/19 05:20
+ * @Description: 命令行客户端，列出服务端的服务与方法，以 JSON 参数调用方法
+ */
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/LucienVen/Trpc"
+	"github.com/LucienVen/Trpc/core"
+)
+
+/**
+使用方式：
+	trpcurl tcp@127.0.0.1:9999 list
+	trpcurl tcp@127.0.0.1:9999 list Foo
+	trpcurl tcp@127.0.0.1:9999 describe Foo.Sum
+	trpcurl -d '{"Num1":1,"Num2":2}' tcp@127.0.0.1:9999 Foo.Sum
+	echo '{"Num1":1,"Num2":2}' | trpcurl -d @- unix@/tmp/trpc.sock Foo.Sum
+地址格式同 Trpc.XDial（tcp@、http@、unix@）；list 与 describe 需要服务端调用 RegisterReflection，服务端需要支持 JSON 编解码
+*/
+
+const usage = `usage:
+	trpcurl [flags] <protocol@addr> list [service]
+	trpcurl [flags] <protocol@addr> describe <service|Service.Method>
+	trpcurl [flags] -d <json> <protocol@addr> <Service.Method>
+
+flags:
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "trpcurl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("trpcurl", flag.ContinueOnError)
+	data := fs.String("d", "{}", "JSON args of the call, @file reads from file, @- reads from stdin")
+	timeout := fs.Duration("timeout", 5*time.Second, "timeout of the connection and the call")
+	credential := fs.String("credential", "", "credential sent to the server, see Server.Authenticate")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return errors.New("missing address or command")
+	}
+
+	client, err := Trpc.XDial(fs.Arg(0), &Trpc.Option{
+		CodecType:      core.JosnType,
+		ConnectTimeout: *timeout,
+		Credential:     *credential,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = client.Close() }()
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	switch fs.Arg(1) {
+	case "list":
+		return list(ctx, client, fs.Arg(2), stdout)
+	case "describe":
+		if fs.NArg() != 3 {
+			return errors.New("describe expects a service or Service.Method")
+		}
+		return describe(ctx, client, fs.Arg(2), stdout)
+	}
+	if fs.NArg() > 2 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args()[2:], " "))
+	}
+
+	body, err := readArgs(*data, stdin)
+	if err != nil {
+		return err
+	}
+	return call(ctx, client, fs.Arg(1), body, stdout)
+}
+
+// 读取调用参数，@file 从文件读取，@- 从标准输入读取
+func readArgs(data string, stdin io.Reader) (json.RawMessage, error) {
+	var body []byte
+	var err error
+	switch {
+	case data == "@-":
+		body, err = ioutil.ReadAll(stdin)
+	case strings.HasPrefix(data, "@"):
+		body, err = ioutil.ReadFile(data[1:])
+	default:
+		body = []byte(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	body = bytes.TrimSpace(body)
+	if !json.Valid(body) {
+		return nil, errors.New("args are not valid JSON")
+	}
+	return body, nil
+}
+
+// 以 JSON 参数调用方法，格式化输出 JSON 响应
+func call(ctx context.Context, client *Trpc.Client, serviceMethod string, args json.RawMessage, stdout io.Writer) error {
+	var reply json.RawMessage
+	if err := client.Call(ctx, serviceMethod, args, &reply); err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, reply, "", "  "); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+	_, err := out.WriteTo(stdout)
+	return err
+}
+
+// 通过 Reflection 服务获取服务的描述
+func listServices(ctx context.Context, client *Trpc.Client, service string) ([]Trpc.ServiceInfo, error) {
+	var services []Trpc.ServiceInfo
+	err := client.Call(ctx, "Reflection.List", Trpc.ListArgs{Service: service}, &services)
+	if err != nil && Trpc.ErrorCode(err) == Trpc.CodeNotFound && strings.Contains(err.Error(), "Reflection") {
+		return nil, fmt.Errorf("%v (does the server call RegisterReflection?)", err)
+	}
+	return services, err
+}
+
+// 列出服务与方法
+func list(ctx context.Context, client *Trpc.Client, service string, stdout io.Writer) error {
+	services, err := listServices(ctx, client, service)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	for _, svc := range services {
+		for _, m := range svc.Methods {
+			if m.Stream {
+				fmt.Fprintf(w, "%s.%s\t(stream)\t\n", svc.Name, m.Name)
+				continue
+			}
+			fmt.Fprintf(w, "%s.%s\t(%s, %s)\t\n", svc.Name, m.Name, m.ArgType, m.ReplyType)
+		}
+	}
+	return w.Flush()
+}
+
+// 以 JSON 输出服务或方法的描述，包括参数与响应类型的结构
+func describe(ctx context.Context, client *Trpc.Client, name string, stdout io.Writer) error {
+	service, method := name, ""
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		service, method = name[:dot], name[dot+1:]
+	}
+	services, err := listServices(ctx, client, service)
+	if err != nil {
+		return err
+	}
+
+	var v interface{} = services[0]
+	if method != "" {
+		v = nil
+		for _, m := range services[0].Methods {
+			if m.Name == method {
+				v = m
+				break
+			}
+		}
+		if v == nil {
+			return fmt.Errorf("can't find method %s", name)
+		}
+	}
+
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/LucienVen/Trpc"
+)
+
+type Calc int
+
+type Args struct {
+	Num1, Num2 int
+}
+
+func (c Calc) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	server := Trpc.NewServer()
+	var calc Calc
+	_ = server.Register(&calc)
+	_ = server.RegisterReflection()
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+	addr := "tcp@" + l.Addr().String()
+
+	var out bytes.Buffer
+	if err := run([]string{addr, "list"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Calc.Sum") || !strings.Contains(out.String(), "(main.Args, *int)") ||
+		!strings.Contains(out.String(), "Reflection.List") {
+		t.Fatalf("unexpected list output:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := run([]string{addr, "describe", "Calc.Sum"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	var m Trpc.MethodInfo
+	if err := json.Unmarshal(out.Bytes(), &m); err != nil || m.Args == nil || len(m.Args.Fields) != 2 ||
+		m.Args.Fields[1].Name != "Num2" || m.Reply.Elem.Kind != "int" {
+		t.Fatalf("unexpected describe output: %v\n%s", err, out.String())
+	}
+
+	out.Reset()
+	if err := run([]string{"-d", `{"Num1":1,"Num2":2}`, addr, "Calc.Sum"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "3\n" {
+		t.Fatalf("unexpected reply %q", out.String())
+	}
+
+	// 从标准输入读取参数
+	out.Reset()
+	if err := run([]string{"-d", "@-", addr, "Calc.Sum"}, strings.NewReader(`{"Num1":2,"Num2":2}`), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "4\n" {
+		t.Fatalf("unexpected reply %q", out.String())
+	}
+
+	if err := run([]string{addr, "Calc.Missing"}, nil, &out); err == nil || Trpc.ErrorCode(err) != Trpc.CodeNotFound {
+		t.Fatalf("expect not found, but got %v", err)
+	}
+}
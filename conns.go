@@ -0,0 +1,130 @@
+/**
+ * @Author : liangliangtoo
+ * @File : conns
+ * @Date: 2026/10/19 00:10
+ * @Description: 记录服务端的连接，供调试页面查看，通过 CloseConnHandler 强制关闭
+ */
+package Trpc
+
+import (
+	"io"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/LucienVen/Trpc/core"
+)
+
+// 统计读写字节数的连接
+type countingConn struct {
+	io.ReadWriteCloser
+	bytesIn  uint64
+	bytesOut uint64
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	atomic.AddUint64(&c.bytesIn, uint64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Write(p)
+	atomic.AddUint64(&c.bytesOut, uint64(n))
+	return n, err
+}
+
+// 编解码器已读取的字节数，只在读循环中调用
+func (sc *serverConn) consumed() uint64 {
+	// 编解码器预读时，以它实际解码的字节数为准
+	if ic, ok := sc.cc.(core.InputCounter); ok {
+		return uint64(ic.InputOffset())
+	}
+	if sc.reader == nil {
+		return 0
+	}
+	return sc.reader.consumed
+}
+
+// 已写出的字节数
+func (sc *serverConn) bytesOut() uint64 {
+	if sc.conn == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&sc.conn.bytesOut)
+}
+
+// ConnInfo 连接的信息
+type ConnInfo struct {
+	ID          uint64    `json:"id"`
+	RemoteAddr  string    `json:"remoteAddr"`
+	Identity    string    `json:"identity"` // 调用方身份，见 Server.Authenticate
+	Codec       string    `json:"codec"`
+	ConnectedAt time.Time `json:"connectedAt"`
+	Requests    uint64    `json:"requests"` // 收到的请求数（普通、单向、批量调用与流）
+	InFlight    int32     `json:"inFlight"` // 正在处理的请求与流
+	BytesIn     uint64    `json:"bytesIn"`
+	BytesOut    uint64    `json:"bytesOut"`
+}
+
+func (sc *serverConn) info() ConnInfo {
+	info := ConnInfo{
+		ID:          sc.id,
+		RemoteAddr:  sc.remoteAddr,
+		Identity:    sc.identity,
+		Codec:       string(sc.opt.CodecType),
+		ConnectedAt: sc.connectedAt,
+		Requests:    atomic.LoadUint64(&sc.requests),
+		InFlight:    atomic.LoadInt32(&sc.active),
+	}
+	if sc.conn != nil {
+		info.BytesIn = atomic.LoadUint64(&sc.conn.bytesIn)
+		info.BytesOut = atomic.LoadUint64(&sc.conn.bytesOut)
+	}
+	return info
+}
+
+func (s *Server) addConn(sc *serverConn) {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	if s.conns == nil {
+		s.conns = make(map[uint64]*serverConn)
+	}
+	s.nextConnID++
+	sc.id = s.nextConnID
+	s.conns[sc.id] = sc
+}
+
+func (s *Server) removeConn(sc *serverConn) {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	delete(s.conns, sc.id)
+}
+
+// Conns 返回当前所有连接的信息，按连接时间排序
+func (s *Server) Conns() []ConnInfo {
+	s.connMu.Lock()
+	conns := make([]*serverConn, 0, len(s.conns))
+	for _, sc := range s.conns {
+		conns = append(conns, sc)
+	}
+	s.connMu.Unlock()
+
+	infos := make([]ConnInfo, 0, len(conns))
+	for _, sc := range conns {
+		infos = append(infos, sc.info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// CloseConn 强制关闭连接，进行中的请求与流随之中止
+func (s *Server) CloseConn(id uint64) error {
+	s.connMu.Lock()
+	sc := s.conns[id]
+	s.connMu.Unlock()
+	if sc == nil {
+		return Errorf(CodeNotFound, "rpc server: can't find connection %d", id)
+	}
+	return sc.cc.Close()
+}
@@ -10,8 +10,34 @@ import "io"
 
 type Header struct {
 	ServiceMethod string // format "Service.Method" 服务名.方法名
-	Seq           uint64 // 请求的序号
+	Seq           uint64 // 请求的序号（流消息中即为流ID）
 	Error         string
+	Code          uint32            // 错误码，Error 非空时有效
+	Kind          Kind              // 帧类型，零值为普通调用
+	Meta          map[string]string // 元数据
+}
+
+// Kind 帧类型，同一连接上复用普通调用与流
+type Kind uint8
+
+const (
+	KindCall         Kind = iota // 普通调用的请求/响应
+	KindStreamOpen               // 打开流
+	KindStreamData               // 流消息，body 为编码后的 []byte
+	KindStreamClose              // 半关闭，服务端发送时携带流的最终错误
+	KindStreamWindow             // 流控，body 为归还的发送窗口数量
+	KindStreamReset              // 异常中止流
+	KindNotify                   // 单向调用，服务端不回复
+	KindBatch                    // 批量调用，一帧携带多个请求/响应
+	KindCallback                 // 服务端发起的回调请求
+	KindCallbackReply            // 客户端对回调的响应
+	KindPing                     // 心跳探测
+	KindPong                     // 心跳回复
+)
+
+// IsStream 是否为流相关的帧
+func (k Kind) IsStream() bool {
+	return k >= KindStreamOpen && k <= KindStreamReset
 }
 
 // Codec 对消息体进行编码/解码的接口
@@ -22,6 +48,10 @@ type Codec interface {
 	Write(*Header, interface{}) error
 }
 
+// InputCounter 由会预读的编解码器实现，返回实际解码的字节数
+type InputCounter interface {
+	InputOffset() int64
+}
 
 type NewCodecFunc func(io.ReadWriteCloser) Codec
 
@@ -41,6 +71,7 @@ func init() {
 
 	//TODO
 	NewCodecFuncMap[GobType] = NewGobCodec
+	NewCodecFuncMap[JosnType] = NewJsonCodec
 }
 
 
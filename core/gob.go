@@ -10,7 +10,6 @@ import (
 	"bufio"
 	"encoding/gob"
 	"io"
-	"log"
 )
 
 type GobCodec struct {
@@ -51,13 +50,12 @@ func (c *GobCodec) Write(h *Header, body interface{}) error {
 		}
 	}()
 
+	// 编码错误返回给调用方，由调用方记录日志
 	if err := c.enc.Encode(h); err != nil {
-		log.Println("rpc codec: gob error encoding Header:", err)
 		return err
 	}
 
 	if err := c.enc.Encode(body); err != nil {
-		log.Println("rpc codec: gob error encoding Body:", err)
 		return err
 	}
 
@@ -0,0 +1,82 @@
+/**
+ * @Author : liangliangtoo
+ * @File : json
+ * @Date: 2026/10/19 03:20
+ * @Description: JSON 编解码，请求与响应可以不依赖 Go 类型解析，供录制回放、命令行等工具使用
+ */
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+type JsonCodec struct {
+	conn io.ReadWriteCloser
+	buf  *bufio.Writer
+	dec  *json.Decoder
+	enc  *json.Encoder
+}
+
+var _ Codec = (*JsonCodec)(nil)
+
+func NewJsonCodec(conn io.ReadWriteCloser) Codec {
+	buf := bufio.NewWriter(conn)
+	return &JsonCodec{
+		conn: conn,
+		buf:  buf,
+		dec:  json.NewDecoder(conn),
+		enc:  json.NewEncoder(buf),
+	}
+}
+
+/** 实现codec方法 **/
+
+func (c *JsonCodec) ReadHeader(h *Header) error {
+	return c.dec.Decode(h)
+}
+
+func (c *JsonCodec) ReadBody(body interface{}) error {
+	// body 为 nil 时丢弃消息体
+	if body == nil {
+		var discard json.RawMessage
+		return c.dec.Decode(&discard)
+	}
+	return c.dec.Decode(body)
+}
+
+func (c *JsonCodec) Write(h *Header, body interface{}) error {
+	defer func() {
+		err := c.buf.Flush()
+		if err != nil {
+			_ = c.Close()
+		}
+	}()
+
+	// 编码错误返回给调用方，由调用方记录日志
+	if err := c.enc.Encode(h); err != nil {
+		return err
+	}
+
+	if err := c.enc.Encode(body); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// InputOffset 已解码的字节数，json.Decoder 会预读，连接上读取的字节数并不准确
+func (c *JsonCodec) InputOffset() int64 {
+	n := c.dec.InputOffset()
+	// 编码时每条消息后跟一个换行符，计入这条消息
+	var b [1]byte
+	if m, _ := c.dec.Buffered().Read(b[:]); m == 1 && b[0] == '\n' {
+		n++
+	}
+	return n
+}
+
+func (c *JsonCodec) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,45 @@
+/**
+ * @Author : liangliangtoo
+ * @File : payload
+ * @Date: 2026/10/18 10:12
+ * @Description: 独立编码的消息体，用于流消息等需要延迟解码的场景
+ */
+package core
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+)
+
+// Marshal 按编解码类型将 v 编码为独立的字节序列
+func Marshal(t Ttype, v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	switch t {
+	case GobType:
+		if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+			return nil, err
+		}
+	case JosnType:
+		if err := json.NewEncoder(&buf).Encode(v); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("rpc codec: invalid codec type %s", t)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Unmarshal 将 Marshal 得到的字节序列解码到 v（v 必须为指针）
+func Unmarshal(t Ttype, data []byte, v interface{}) error {
+	switch t {
+	case GobType:
+		return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+	case JosnType:
+		return json.Unmarshal(data, v)
+	default:
+		return fmt.Errorf("rpc codec: invalid codec type %s", t)
+	}
+}
@@ -1,28 +1,68 @@
 package Trpc
 
 import (
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
 )
 
 const debugText = `<html>
 	<body>
 	<title>GeeRPC Services</title>
-	{{range .}}
+	{{range .Services}}
 	<hr>
 	Service {{.Name}}
 	<hr>
 		<table>
-		<th align=center>Method</th><th align=center>Calls</th>
+		<th align=center>Method</th><th align=center>Calls</th><th align=center>Errors</th><th align=center>Last Error</th>
+		<th align=center>In-Flight</th><th align=center>Avg</th><th align=center>P50</th><th align=center>P95</th><th align=center>P99</th>
 		{{range $name, $mtype := .Method}}
 			<tr>
+			{{if $mtype.IsStream}}
+			<td align=left font=fixed>{{$name}}(*Trpc.ServerStream) error</td>
+			{{else}}
 			<td align=left font=fixed>{{$name}}({{$mtype.ArgType}}, {{$mtype.ReplyType}}) error</td>
+			{{end}}
 			<td align=center>{{$mtype.NumCalls}}</td>
+			<td align=center>{{$mtype.ErrorCount}}</td>
+			<td align=left>{{$mtype.LastError}}</td>
+			<td align=center>{{$mtype.InFlight}}</td>
+			{{with $mtype.Latency}}
+			<td align=center>{{.Avg}}</td>
+			<td align=center>{{.P50}}</td>
+			<td align=center>{{.P95}}</td>
+			<td align=center>{{.P99}}</td>
+			{{end}}
 			</tr>
 		{{end}}
 		</table>
 	{{end}}
+	<hr>
+	Connections
+	<hr>
+		<table>
+		<th align=center>ID</th><th align=center>Remote</th><th align=center>Identity</th><th align=center>Codec</th>
+		<th align=center>Connected</th><th align=center>Requests</th><th align=center>In-Flight</th>
+		<th align=center>Bytes In</th><th align=center>Bytes Out</th>
+		{{range .Conns}}
+			<tr>
+			<td align=center>{{.ID}}</td>
+			<td align=left>{{.RemoteAddr}}</td>
+			<td align=left>{{.Identity}}</td>
+			<td align=left>{{.Codec}}</td>
+			<td align=left>{{.ConnectedAt.Format "2006-01-02 15:04:05"}}</td>
+			<td align=center>{{.Requests}}</td>
+			<td align=center>{{.InFlight}}</td>
+			<td align=center>{{.BytesIn}}</td>
+			<td align=center>{{.BytesOut}}</td>
+			</tr>
+		{{end}}
+		</table>
 	</body>
 	</html>`
 
@@ -38,7 +78,13 @@ type debugService struct {
 	Method map[string]*methodType
 }
 
+type debugPage struct {
+	Services []debugService
+	Conns    []ConnInfo
+}
+
 // 将返回一个 HTML 报文，这个报文将展示注册所有的 service 的每一个方法的调用情况
+// 以及所有的连接；页面只读，关闭连接见 CloseConnHandler
 func (server debugHTTP) ServeHTTP(w http.ResponseWriter, req *http.Request)  {
 	var services []debugService
 	server.serviceMap.Range(func(namei, svci interface{}) bool {
@@ -51,9 +97,135 @@ func (server debugHTTP) ServeHTTP(w http.ResponseWriter, req *http.Request)  {
 		return true
 	})
 
-	err := debug.Execute(w, services)
+	if wantJSON(req) {
+		server.serveJSON(w, services)
+		return
+	}
+
+	err := debug.Execute(w, debugPage{Services: services, Conns: server.Conns()})
 	if err != nil {
 		_, _ = fmt.Fprintln(w, "rpc: error executing template:", err.Error())
 	}
 }
 
+
+/** JSON **/
+
+type debugJSON struct {
+	Services    []debugServiceJSON `json:"services"`
+	Connections debugConnsJSON     `json:"connections"`
+}
+
+type debugServiceJSON struct {
+	Name    string            `json:"name"`
+	Methods []debugMethodJSON `json:"methods"`
+}
+
+type debugMethodJSON struct {
+	Name       string       `json:"name"`
+	ArgType    string       `json:"argType,omitempty"`
+	ReplyType  string       `json:"replyType,omitempty"`
+	Stream     bool         `json:"stream"`
+	Idempotent bool         `json:"idempotent"`
+	Calls      uint64       `json:"calls"`
+	Errors     uint64       `json:"errors"`
+	LastError  string       `json:"lastError,omitempty"`
+	InFlight   int64        `json:"inFlight"`
+	Latency    LatencyStats `json:"latency"`
+}
+
+type debugConnsJSON struct {
+	Active int64      `json:"active"`
+	Total  uint64     `json:"total"`
+	Conns  []ConnInfo `json:"conns"`
+}
+
+// ?format=json 或 Accept: application/json 时返回 JSON
+func wantJSON(req *http.Request) bool {
+	if format := req.URL.Query().Get("format"); format != "" {
+		return format == "json"
+	}
+	return strings.Contains(req.Header.Get("Accept"), "application/json")
+}
+
+func (server debugHTTP) serveJSON(w http.ResponseWriter, services []debugService) {
+	out := debugJSON{
+		Services: make([]debugServiceJSON, 0, len(services)),
+		Connections: debugConnsJSON{
+			Active: atomic.LoadInt64(&server.activeConns),
+			Total:  atomic.LoadUint64(&server.totalConns),
+			Conns:  server.Conns(),
+		},
+	}
+
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+	for _, svc := range services {
+		sj := debugServiceJSON{Name: svc.Name, Methods: make([]debugMethodJSON, 0, len(svc.Method))}
+		for name, mtype := range svc.Method {
+			mj := debugMethodJSON{
+				Name:       name,
+				Stream:     mtype.stream,
+				Idempotent: mtype.idempotent,
+				Calls:      mtype.NumCalls(),
+				Errors:     mtype.ErrorCount(),
+				LastError:  mtype.LastError(),
+				InFlight:   mtype.InFlight(),
+				Latency:    mtype.Latency(),
+			}
+			if !mtype.stream {
+				mj.ArgType, mj.ReplyType = mtype.ArgType.String(), mtype.ReplyType.String()
+			}
+			sj.Methods = append(sj.Methods, mj)
+		}
+		sort.Slice(sj.Methods, func(i, j int) bool { return sj.Methods[i].Name < sj.Methods[j].Name })
+		out.Services = append(out.Services, sj)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		_, _ = fmt.Fprintln(w, "rpc: error encoding json:", err.Error())
+	}
+}
+
+/** 关闭连接 **/
+
+/**
+使用方式：
+	http.Handle("/debug/trpc/close", server.CloseConnHandler())
+	curl -X POST -H "X-Trpc-Close-Conn: 3" http://127.0.0.1:9999/debug/trpc/close
+HandleHTTP 不注册该路径，需要时由使用方挂载，建议只在内网或鉴权之后开放
+连接 ID 只能通过请求头传递：跨站的表单无法设置自定义请求头，
+跨站的脚本设置时浏览器会先发起预检，因此跨站请求无法触发关闭
+*/
+
+// HeaderCloseConn 携带要关闭的连接 ID 的请求头
+const HeaderCloseConn = "X-Trpc-Close-Conn"
+
+type closeConnHTTP struct {
+	*Server
+}
+
+// CloseConnHandler 返回强制关闭连接的 http.Handler，只接受带 HeaderCloseConn 的 POST 请求
+func (s *Server) CloseConnHandler() http.Handler {
+	return closeConnHTTP{s}
+}
+
+func (server closeConnHTTP) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "rpc: method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseUint(req.Header.Get(HeaderCloseConn), 10, 64)
+	if err != nil {
+		http.Error(w, "rpc: missing or invalid "+HeaderCloseConn+" header", http.StatusBadRequest)
+		return
+	}
+	if err = server.CloseConn(id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	server.logger().Log(LevelInfo, "rpc server: connection closed over http", F("id", id), F("by", req.RemoteAddr))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,121 @@
+package Trpc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecentLatency(t *testing.T) {
+	t.Parallel()
+
+	var w recentLatency
+	now := time.Now()
+	w.add(now.Add(-2*statsWindow), time.Hour)
+	for i := 1; i <= 100; i++ {
+		w.add(now, time.Duration(i)*time.Millisecond)
+	}
+	st := w.stats(now)
+	_assert(st.Count == 100, "samples outside the window should be ignored, got %d", st.Count)
+	_assert(st.P50 == 50*time.Millisecond && st.P95 == 95*time.Millisecond && st.P99 == 99*time.Millisecond,
+		"unexpected percentiles %+v", st)
+	_assert(st.Avg == 50500*time.Microsecond, "unexpected average %s", st.Avg)
+}
+
+func TestDebugHTTP(t *testing.T) {
+	t.Parallel()
+
+	server := NewServer()
+	_ = server.Register(&Flaky{fails: map[string]int{"Put": 1}})
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+
+	client, _ := Dial("tcp", l.Addr().String())
+	defer func() { _ = client.Close() }()
+	var reply int
+	_ = client.Call(context.Background(), "Flaky.Put", 1, &reply)
+
+	w := httptest.NewRecorder()
+	debugHTTP{server}.ServeHTTP(w, httptest.NewRequest("GET", defaultDebugPath, nil))
+	body := w.Body.String()
+	_assert(strings.Contains(body, "flaky: Put unavailable"), "debug page should show the last error:\n%s", body)
+	_assert(strings.Contains(body, "<th align=center>P99</th>"), "debug page should show latency percentiles")
+
+	w = httptest.NewRecorder()
+	debugHTTP{server}.ServeHTTP(w, httptest.NewRequest("GET", defaultDebugPath+"?format=json", nil))
+	var out debugJSON
+	err := json.Unmarshal(w.Body.Bytes(), &out)
+	_assert(err == nil, "invalid json: %v", err)
+	_assert(len(out.Services) == 1 && out.Services[0].Name == "Flaky", "unexpected services %+v", out.Services)
+	put := out.Services[0].Methods[1]
+	_assert(put.Name == "Put" && put.ArgType == "int" && put.ReplyType == "*int", "unexpected method %+v", put)
+	_assert(put.Calls == 1 && put.Errors == 1 && put.Latency.Count == 1, "unexpected stats %+v", put)
+	_assert(out.Connections.Active == 1 && out.Connections.Total == 1, "unexpected connections %+v", out.Connections)
+
+	req := httptest.NewRequest("GET", defaultDebugPath, nil)
+	req.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	debugHTTP{server}.ServeHTTP(w, req)
+	_assert(strings.HasPrefix(w.Header().Get("Content-Type"), "application/json"), "Accept header should select json")
+}
+
+func TestServer_Conns(t *testing.T) {
+	t.Parallel()
+
+	server := NewServer()
+	var foo Foo
+	_ = server.Register(&foo)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+
+	client, _ := Dial("tcp", l.Addr().String())
+	defer func() { _ = client.Close() }()
+	var reply int
+	_ = client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+
+	conns := server.Conns()
+	_assert(len(conns) == 1, "expect 1 connection, but got %d", len(conns))
+	c := conns[0]
+	_assert(c.Codec == "application/gob" && c.Requests == 1 && c.InFlight == 0, "unexpected connection %+v", c)
+	_assert(c.BytesIn > 0 && c.BytesOut > 0 && c.RemoteAddr != "", "unexpected connection %+v", c)
+
+	w := httptest.NewRecorder()
+	debugHTTP{server}.ServeHTTP(w, httptest.NewRequest("GET", defaultDebugPath, nil))
+	_assert(strings.Contains(w.Body.String(), c.RemoteAddr), "debug page should list connections")
+
+	// 未带请求头的表单提交（跨站请求的形式）不能关闭连接
+	handler := server.CloseConnHandler()
+	req := httptest.NewRequest("POST", "/close", strings.NewReader("close="+strconv.FormatUint(c.ID, 10)))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	_assert(w.Code == 400, "expect 400 without the header, but got %d", w.Code)
+
+	req = httptest.NewRequest("GET", "/close", nil)
+	req.Header.Set(HeaderCloseConn, strconv.FormatUint(c.ID, 10))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	_assert(w.Code == 405, "expect 405 for GET, but got %d", w.Code)
+
+	req = httptest.NewRequest("POST", "/close", nil)
+	req.Header.Set(HeaderCloseConn, "12345")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	_assert(w.Code == 404, "expect 404 for unknown connection, but got %d", w.Code)
+	_assert(client.IsAvailable(), "rejected requests should not close the connection")
+
+	req = httptest.NewRequest("POST", "/close", nil)
+	req.Header.Set(HeaderCloseConn, strconv.FormatUint(c.ID, 10))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	_assert(w.Code == 204, "expect 204 after closing, but got %d", w.Code)
+
+	<-client.done
+	err := client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_assert(ErrorCode(err) == CodeUnavailable, "closed connection should be unavailable, but got %v", err)
+}
@@ -0,0 +1,279 @@
+/**
+ * @Author : liangliangtoo
+ * @File : hedge
+ * @Date: 2026/10/18 19:40
+ * @Description: 对冲请求，第一个后端迟迟不回复时向第二个后端发送相同的调用
+ */
+package Trpc
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+/**
+对冲流程：
+	1. 向 addrs[0] 发送调用
+	2. 等待该方法最近延迟的 Percentile 分位，仍未回复时向 addrs[1] 发送相同的调用
+	3. 第一个成功的回复写入 reply，另一个调用被取消
+只有幂等的方法才会对冲，每个调用使用独立的 reply 对象，避免并发写入
+取消只发生在客户端：不再等待落后调用的回复，协议中没有取消帧，服务端仍会执行完落后的调用
+延迟样本包括成功的调用、被取消的调用（已等待的时间，作为下限）与超时的调用，
+只统计成功的调用会让分位偏低，对冲越来越频繁
+*/
+
+// HedgeOption 对冲配置
+type HedgeOption struct {
+	Percentile float64       // 以最近延迟的该分位作为对冲前的等待时间（0~1），默认0.95
+	MinDelay   time.Duration // 等待时间下限，样本不足时也使用该值，默认10ms
+	Samples    int           // 每个方法保留的最近延迟样本数，默认100
+	Idempotent []string      // 调用方标记为幂等的方法，格式 Service.Method
+}
+
+var DefaultHedgeOption = &HedgeOption{
+	Percentile: 0.95,
+	MinDelay:   time.Millisecond * 10,
+	Samples:    100,
+}
+
+// 计算分位前需要的最少样本数
+const minHedgeSamples = 10
+
+func parseHedgeOption(opt *HedgeOption) HedgeOption {
+	if opt == nil {
+		opt = DefaultHedgeOption
+	}
+
+	o := *opt
+	if o.Percentile <= 0 || o.Percentile >= 1 {
+		o.Percentile = DefaultHedgeOption.Percentile
+	}
+	if o.MinDelay <= 0 {
+		o.MinDelay = DefaultHedgeOption.MinDelay
+	}
+	if o.Samples < minHedgeSamples {
+		o.Samples = DefaultHedgeOption.Samples
+	}
+	return o
+}
+
+// 每个方法最近的延迟样本
+type latencyWindow struct {
+	samples []time.Duration
+	next    int
+}
+
+type hedger struct {
+	opt     HedgeOption
+	mu      sync.Mutex
+	methods map[string]*latencyWindow
+}
+
+func newHedger(opt *HedgeOption) *hedger {
+	return &hedger{opt: parseHedgeOption(opt), methods: make(map[string]*latencyWindow)}
+}
+
+func (h *hedger) record(serviceMethod string, d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	w := h.methods[serviceMethod]
+	if w == nil {
+		w = &latencyWindow{samples: make([]time.Duration, 0, h.opt.Samples)}
+		h.methods[serviceMethod] = w
+	}
+	if len(w.samples) < h.opt.Samples {
+		w.samples = append(w.samples, d)
+		return
+	}
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % len(w.samples)
+}
+
+// 对冲前的等待时间
+func (h *hedger) delay(serviceMethod string) time.Duration {
+	h.mu.Lock()
+	w := h.methods[serviceMethod]
+	if w == nil || len(w.samples) < minHedgeSamples {
+		h.mu.Unlock()
+		return h.opt.MinDelay
+	}
+	samples := append([]time.Duration(nil), w.samples...)
+	h.mu.Unlock()
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	d := samples[int(float64(len(samples)-1)*h.opt.Percentile)]
+	if d < h.opt.MinDelay {
+		d = h.opt.MinDelay
+	}
+	return d
+}
+
+func (h *hedger) isIdempotent(serviceMethod string) bool {
+	for _, m := range h.opt.Idempotent {
+		if m == serviceMethod {
+			return true
+		}
+	}
+	return false
+}
+
+// 一次对冲中的单个调用
+type hedgeCall struct {
+	client  *Client
+	call    *Call
+	breaker *Breaker
+	gen     uint64 // 熔断器放行时的 generation
+	start   time.Time
+}
+
+// 在 rpcAddr 上异步发送调用，熔断器打开时返回错误
+func (p *Pool) goHedge(ctx context.Context, rpcAddr, serviceMethod string, args, reply interface{}, done chan *Call) (*hedgeCall, error) {
+	hc := &hedgeCall{breaker: p.Breaker(rpcAddr)}
+	if hc.breaker != nil {
+		gen, err := hc.breaker.Allow()
+		if err != nil {
+			return nil, err
+		}
+		hc.gen = gen
+	}
+
+	client, err := p.Get(rpcAddr)
+	if err != nil {
+		if hc.breaker != nil {
+			hc.breaker.Done(hc.gen, err)
+		}
+		return nil, err
+	}
+
+	hc.client, hc.start = client, time.Now()
+	hc.call = client.GoContext(ctx, serviceMethod, args, reply, done)
+	return hc, nil
+}
+
+// 调用结束，成功或超时时记录延迟；其他错误（如连接被拒绝）通常很快返回，不能反映方法的延迟
+func (p *Pool) finishHedge(hc *hedgeCall, err error) {
+	if hc.breaker != nil {
+		hc.breaker.Done(hc.gen, err)
+	}
+	if err == nil || ErrorCode(err) == CodeDeadlineExceeded {
+		p.hedges.record(hc.call.ServiceMethod, time.Since(hc.start))
+	}
+}
+
+// 取消未完成的调用，已等待的时间作为延迟的下限记录
+// 只是不再等待回复，服务端不会收到取消
+func (p *Pool) cancelHedge(hc *hedgeCall) {
+	hc.client.removeCall(hc.call.Seq)
+	if hc.breaker != nil {
+		hc.breaker.Cancel(hc.gen)
+	}
+	p.hedges.record(hc.call.ServiceMethod, time.Since(hc.start))
+}
+
+// HedgedCall 在 addrs[0] 上调用，等待超过该方法延迟的 Percentile 分位时向 addrs[1] 发送相同的调用
+// 第一个成功的回复写入 reply，另一个调用在客户端被取消（服务端仍会执行完）；
+// 方法不是幂等的（服务端未声明，且不在 HedgeOption.Idempotent 中）或 addrs 少于两个时等同于 Call
+func (p *Pool) HedgedCall(ctx context.Context, addrs []string, serviceMethod string, args, reply interface{}) error {
+	if len(addrs) == 0 {
+		return Errorf(CodeInvalidArgument, "rpc pool: no address to call")
+	}
+	if len(addrs) < 2 || !p.hedgeable(addrs[0], serviceMethod) {
+		return p.Call(ctx, addrs[0], serviceMethod, args, reply)
+	}
+
+	replyType := reflect.TypeOf(reply)
+	if replyType == nil || replyType.Kind() != reflect.Ptr || reflect.ValueOf(reply).IsNil() {
+		return Errorf(CodeInvalidArgument, "rpc pool: reply must be a non-nil pointer")
+	}
+	replyType = replyType.Elem()
+	done := make(chan *Call, 2)
+	replies := make(map[*Call]reflect.Value, 2)
+	var calls []*hedgeCall
+
+	send := func(addr string) error {
+		replyv := reflect.New(replyType)
+		hc, err := p.goHedge(ctx, addr, serviceMethod, args, replyv.Interface(), done)
+		if err != nil {
+			return err
+		}
+		replies[hc.call] = replyv
+		calls = append(calls, hc)
+		return nil
+	}
+
+	var lastErr error
+	if lastErr = send(addrs[0]); lastErr != nil {
+		// 第一个后端不可用时直接使用第二个
+		if err := send(addrs[1]); err != nil {
+			return lastErr
+		}
+	}
+
+	timer := time.NewTimer(p.hedges.delay(serviceMethod))
+	defer timer.Stop()
+	hedged := len(calls) > 1 || lastErr != nil
+
+	for pending := len(calls); ; {
+		select {
+		case <-timer.C:
+			if !hedged {
+				hedged = true
+				if err := send(addrs[1]); err == nil {
+					pending++
+				}
+			}
+			continue
+		case <-ctx.Done():
+			for _, hc := range calls {
+				p.cancelHedge(hc)
+			}
+			return contextError("rpc client: call failed", ctx)
+		case call := <-done:
+			pending--
+			for i, hc := range calls {
+				if hc.call != call {
+					continue
+				}
+				p.finishHedge(hc, call.Error)
+				calls = append(calls[:i], calls[i+1:]...)
+				break
+			}
+
+			if call.Error == nil {
+				for _, hc := range calls {
+					p.cancelHedge(hc)
+				}
+				reflect.ValueOf(reply).Elem().Set(replies[call].Elem())
+				return nil
+			}
+			lastErr = call.Error
+		}
+
+		// 所有调用都失败，且不会再发送对冲请求
+		if pending == 0 && hedged {
+			return lastErr
+		}
+		if pending == 0 {
+			// 第一个调用在对冲之前就失败了，立即尝试第二个后端
+			hedged = true
+			if err := send(addrs[1]); err != nil {
+				return lastErr
+			}
+			pending++
+		}
+	}
+}
+
+// 方法是否可以对冲
+func (p *Pool) hedgeable(rpcAddr, serviceMethod string) bool {
+	if p.hedges.isIdempotent(serviceMethod) {
+		return true
+	}
+
+	client, err := p.Get(rpcAddr)
+	return err == nil && client.IsIdempotent(serviceMethod)
+}
@@ -0,0 +1,229 @@
+/**
+ * @Author : liangliangtoo
+ * @File : limiter
+ * @Date: 2026/10/18 20:20
+ * @Description: 服务端并发限制与过载保护
+ */
+package Trpc
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+/**
+使用方式：
+	server := Trpc.NewServer()
+	server.Limiter = Trpc.NewLimiter(&Trpc.LimitOption{MaxConcurrent: 100, QueueSize: 1000})
+达到并发上限的请求进入有界队列等待，队列满时直接回复 CodeResourceExhausted
+队列按请求优先级排序，同一优先级先到先执行
+每个排队的请求占用一个 goroutine，因此 goroutine 数量不超过 MaxConcurrent + QueueSize
+流从打开到处理函数返回一直占用名额；处理超时后名额在处理函数真正返回时才归还
+*/
+
+// LimitOption 并发限制配置
+type LimitOption struct {
+	MaxConcurrent      int              // 同时处理的请求数上限，默认0代表不限制
+	MethodConcurrent   map[string]int   // 单个方法（Service.Method）同时处理的请求数上限
+	PriorityConcurrent map[Priority]int // 单个优先级同时处理的请求数上限，用于给低优先级的请求划定份额
+	QueueSize          int              // 达到上限后最多排队的请求数，默认0代表直接拒绝
+
+	// 自适应限制（AIMD）：从 MaxConcurrent 开始，处理延迟超过 TargetLatency 时上限乘以 Backoff，
+	// 否则每处理约“上限”个请求，上限加一，最大不超过 MaxConcurrent
+	Adaptive      bool
+	TargetLatency time.Duration // 目标处理延迟，默认100ms
+	MinConcurrent int           // 自适应的下限，默认1
+	Backoff       float64       // 延迟超标时的缩减比例（0~1），默认0.9
+}
+
+// 自适应限制的默认目标延迟
+const defaultTargetLatency = time.Millisecond * 100
+
+// Limiter 服务端的并发限制器，作用于普通调用、单向调用、批量调用中的每个请求与流
+type Limiter struct {
+	opt LimitOption
+
+	mu       sync.Mutex
+	limit    float64 // 当前的全局上限，非自适应时等于 MaxConcurrent
+	inflight int
+	methods  map[string]int   // 各方法正在处理的请求数
+	lanes    map[Priority]int // 各优先级正在处理的请求数
+	queue    []*ticket        // 按优先级从高到低排列
+}
+
+// 一个请求占用的名额
+type ticket struct {
+	l        *Limiter
+	method   string
+	priority Priority
+	ready    chan struct{} // 获得名额时关闭
+	start    time.Time
+}
+
+// NewLimiter 创建并发限制器
+func NewLimiter(opt *LimitOption) *Limiter {
+	l := &Limiter{methods: make(map[string]int), lanes: make(map[Priority]int)}
+	if opt != nil {
+		l.opt = *opt
+	}
+	if l.opt.Adaptive {
+		if l.opt.MinConcurrent <= 0 {
+			l.opt.MinConcurrent = 1
+		}
+		if l.opt.MaxConcurrent < l.opt.MinConcurrent {
+			l.opt.MaxConcurrent = l.opt.MinConcurrent
+		}
+		if l.opt.Backoff <= 0 || l.opt.Backoff >= 1 {
+			l.opt.Backoff = 0.9
+		}
+		// 为0时每个请求都超标，上限会一直缩减到 MinConcurrent
+		if l.opt.TargetLatency <= 0 {
+			l.opt.TargetLatency = defaultTargetLatency
+		}
+	}
+	l.limit = float64(l.opt.MaxConcurrent)
+	return l
+}
+
+// Limit 当前的全局上限，0代表不限制
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// 是否还有名额（需持有锁）
+func (l *Limiter) available(method string, priority Priority) bool {
+	if l.limit > 0 && l.inflight >= int(l.limit) {
+		return false
+	}
+	if max, ok := l.opt.MethodConcurrent[method]; ok && l.methods[method] >= max {
+		return false
+	}
+	if max, ok := l.opt.PriorityConcurrent[priority]; ok && l.lanes[priority] >= max {
+		return false
+	}
+	return true
+}
+
+func (l *Limiter) acquire(t *ticket) {
+	l.inflight++
+	l.methods[t.method]++
+	l.lanes[t.priority]++
+	t.start = time.Now()
+	close(t.ready)
+}
+
+// 申请名额，没有名额时排队，队列已满时返回 CodeResourceExhausted
+func (l *Limiter) reserve(method string, priority Priority) (*ticket, error) {
+	t := &ticket{l: l, method: method, priority: priority, ready: make(chan struct{})}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// 队列中的请求都在等待各自方法或优先级的名额，新请求只要有名额即可执行
+	if l.available(method, priority) {
+		l.acquire(t)
+		return t, nil
+	}
+	if len(l.queue) >= l.opt.QueueSize {
+		return nil, Errorf(CodeResourceExhausted, "rpc server: too many requests: %s", method)
+	}
+
+	// 插入到同一优先级的末尾
+	i := len(l.queue)
+	for i > 0 && l.queue[i-1].priority < priority {
+		i--
+	}
+	l.queue = append(l.queue, nil)
+	copy(l.queue[i+1:], l.queue[i:])
+	l.queue[i] = t
+	return t, nil
+}
+
+// 等待获得名额，ctx 结束时放弃
+func (t *ticket) wait(ctx context.Context) error {
+	select {
+	case <-t.ready:
+		return nil
+	case <-ctx.Done():
+		t.cancel()
+		return ctx.Err()
+	}
+}
+
+// 是否已经获得名额
+func (t *ticket) acquired() bool {
+	select {
+	case <-t.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// 放弃排队，已经获得名额时归还
+func (t *ticket) cancel() {
+	l := t.l
+	l.mu.Lock()
+	for i, q := range l.queue {
+		if q == t {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			l.mu.Unlock()
+			return
+		}
+	}
+	l.mu.Unlock()
+
+	t.release()
+}
+
+// 归还名额，并按顺序唤醒可以执行的排队请求
+func (t *ticket) release() {
+	l := t.l
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inflight--
+	l.methods[t.method]--
+	if l.methods[t.method] == 0 {
+		delete(l.methods, t.method)
+	}
+	l.lanes[t.priority]--
+	if l.lanes[t.priority] == 0 {
+		delete(l.lanes, t.priority)
+	}
+	if l.opt.Adaptive {
+		l.adjust(time.Since(t.start))
+	}
+
+	// 某个方法或优先级达到上限时，不阻塞其他排队请求
+	queue := l.queue[:0]
+	for _, q := range l.queue {
+		if l.available(q.method, q.priority) {
+			l.acquire(q)
+			continue
+		}
+		queue = append(queue, q)
+	}
+	for i := len(queue); i < len(l.queue); i++ {
+		l.queue[i] = nil
+	}
+	l.queue = queue
+}
+
+// 加性增、乘性减（需持有锁）
+func (l *Limiter) adjust(latency time.Duration) {
+	if latency > l.opt.TargetLatency {
+		l.limit *= l.opt.Backoff
+		if l.limit < float64(l.opt.MinConcurrent) {
+			l.limit = float64(l.opt.MinConcurrent)
+		}
+		return
+	}
+
+	l.limit += 1 / l.limit
+	if l.limit > float64(l.opt.MaxConcurrent) {
+		l.limit = float64(l.opt.MaxConcurrent)
+	}
+}
@@ -0,0 +1,185 @@
+package Trpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	t.Parallel()
+
+	t.Run("queue", func(t *testing.T) {
+		l := NewLimiter(&LimitOption{MaxConcurrent: 1, QueueSize: 1})
+		t1, err := l.reserve("Foo.Sum", PriorityNormal)
+		_assert(err == nil, "first request should run: %v", err)
+		t2, err := l.reserve("Foo.Sum", PriorityNormal)
+		_assert(err == nil, "second request should be queued: %v", err)
+		_, err = l.reserve("Foo.Sum", PriorityNormal)
+		_assert(ErrorCode(err) == CodeResourceExhausted, "expect CodeResourceExhausted, but got %v", err)
+
+		t1.release()
+		_assert(t2.wait(context.Background()) == nil, "queued request should run after release")
+		t2.release()
+		_assert(l.inflight == 0 && len(l.queue) == 0, "all tickets should be released")
+	})
+
+	t.Run("method", func(t *testing.T) {
+		l := NewLimiter(&LimitOption{MethodConcurrent: map[string]int{"Foo.Sleep": 1}, QueueSize: 1})
+		t1, _ := l.reserve("Foo.Sleep", PriorityNormal)
+		t2, _ := l.reserve("Foo.Sleep", PriorityNormal)
+		t3, err := l.reserve("Foo.Sum", PriorityNormal)
+		_assert(err == nil && t3.wait(context.Background()) == nil, "other methods should not be limited")
+		t3.release()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_assert(t2.wait(ctx) != nil && len(l.queue) == 0, "canceled request should leave the queue")
+		t1.release()
+	})
+
+	t.Run("priority", func(t *testing.T) {
+		l := NewLimiter(&LimitOption{MaxConcurrent: 2, QueueSize: 3, PriorityConcurrent: map[Priority]int{PriorityBatch: 1}})
+		t1, _ := l.reserve("Foo.Sum", PriorityBatch)
+		t2, _ := l.reserve("Foo.Sum", PriorityBatch)
+		_assert(l.inflight == 1, "batch requests should be limited by their share")
+		t3, _ := l.reserve("Foo.Sum", PriorityNormal)
+		_assert(t3.wait(context.Background()) == nil, "other priorities can use the remaining capacity")
+
+		t4, _ := l.reserve("Foo.Sum", PriorityNormal)
+		t5, _ := l.reserve("Foo.Sum", PriorityInteractive)
+		_assert(l.queue[0] == t5 && l.queue[1] == t4 && l.queue[2] == t2, "queue should be ordered by priority")
+
+		t3.release()
+		_assert(t5.wait(context.Background()) == nil, "interactive request should run first")
+		t1.release()
+		_assert(t4.wait(context.Background()) == nil, "normal request should run before batch")
+		t5.release()
+		_assert(t2.wait(context.Background()) == nil, "batch request should run last")
+	})
+
+	t.Run("adaptive", func(t *testing.T) {
+		l := NewLimiter(&LimitOption{MaxConcurrent: 10, Adaptive: true, TargetLatency: time.Millisecond})
+		tk, _ := l.reserve("Foo.Sleep", PriorityNormal)
+		time.Sleep(time.Millisecond * 5)
+		tk.release()
+		_assert(l.Limit() == 9, "limit should decrease when latency is too high, got %d", l.Limit())
+
+		for i := 0; i < 20; i++ {
+			tk, _ = l.reserve("Foo.Sum", PriorityNormal)
+			tk.release()
+		}
+		_assert(l.Limit() == 10, "limit should recover up to MaxConcurrent, got %d", l.Limit())
+
+		// 未设置目标延迟时使用默认值，快速的请求不会缩减上限
+		l = NewLimiter(&LimitOption{MaxConcurrent: 10, Adaptive: true})
+		_assert(l.opt.TargetLatency == defaultTargetLatency, "expect default target latency, got %s", l.opt.TargetLatency)
+		for i := 0; i < 20; i++ {
+			tk, _ = l.reserve("Foo.Sum", PriorityNormal)
+			tk.release()
+		}
+		_assert(l.Limit() == 10, "fast requests should not shrink the limit, got %d", l.Limit())
+	})
+}
+
+func TestServer_Limiter(t *testing.T) {
+	t.Parallel()
+
+	gate := make(Gate)
+	server := NewServer()
+	server.Limiter = NewLimiter(&LimitOption{MaxConcurrent: 1, QueueSize: 1})
+	_ = server.Register(gate)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+
+	client, _ := Dial("tcp", l.Addr().String())
+	defer func() { _ = client.Close() }()
+
+	c1 := client.Go("Gate.Wait", 1, new(int), nil)
+	c2 := client.Go("Gate.Wait", 2, new(int), nil)
+	time.Sleep(time.Millisecond * 100)
+	err := client.Call(context.Background(), "Gate.Wait", 3, new(int))
+	_assert(ErrorCode(err) == CodeResourceExhausted, "expect CodeResourceExhausted, but got %v", err)
+
+	close(gate)
+	_assert((<-c1.Done).Error == nil && (<-c2.Done).Error == nil, "admitted calls should succeed")
+}
+
+func TestServer_LimiterWorkers(t *testing.T) {
+	t.Parallel()
+
+	gate := make(Gate)
+	var foo Foo
+	server := NewServer()
+	server.Limiter = NewLimiter(&LimitOption{MethodConcurrent: map[string]int{"Foo.Sum": 1}, QueueSize: 4})
+	server.Workers = NewWorkerPool(&WorkerOption{Workers: 1, QueueSize: 4})
+	defer server.Workers.Close()
+	_ = server.Register(gate)
+	_ = server.Register(&foo)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+
+	client, _ := Dial("tcp", l.Addr().String())
+	defer func() { _ = client.Close() }()
+
+	// 唯一的 worker 被占用时，c1 获得名额在 worker 队列中等待，高优先级的 c2 在名额队列中等待
+	c0 := client.Go("Gate.Wait", 0, new(int), nil)
+	time.Sleep(time.Millisecond * 50)
+	c1 := client.Go("Foo.Sum", Args{1, 2}, new(int), nil)
+	ctx := WithPriority(context.Background(), PriorityInteractive)
+	c2 := client.GoContext(ctx, "Foo.Sum", Args{3, 4}, new(int), nil)
+	time.Sleep(time.Millisecond * 50)
+	close(gate)
+
+	for _, call := range []*Call{c0, c1, c2} {
+		select {
+		case call := <-call.Done:
+			_assert(call.Error == nil, "expect no error, but got %v", call.Error)
+		case <-time.After(time.Second * 2):
+			t.Fatal("worker should not block waiting for a limiter slot")
+		}
+	}
+}
+
+func TestServer_LimiterTimeout(t *testing.T) {
+	t.Parallel()
+
+	gate := make(Gate)
+	var foo Foo
+	var stream Stream
+	server := NewServer()
+	server.Limiter = NewLimiter(&LimitOption{MaxConcurrent: 1})
+	_ = server.Register(gate)
+	_ = server.Register(&foo)
+	_ = server.Register(&stream)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+
+	client, _ := Dial("tcp", l.Addr().String(), &Option{HandleTimeout: time.Millisecond * 50})
+	defer func() { _ = client.Close() }()
+
+	// 超时后处理函数仍在运行，名额直到它返回才归还
+	err := client.Call(context.Background(), "Gate.Wait", 1, new(int))
+	_assert(ErrorCode(err) == CodeDeadlineExceeded, "expect CodeDeadlineExceeded, but got %v", err)
+	err = client.Call(context.Background(), "Foo.Sum", Args{1, 2}, new(int))
+	_assert(ErrorCode(err) == CodeResourceExhausted, "expect CodeResourceExhausted, but got %v", err)
+
+	// 批量调用中的每个请求同样需要名额
+	items := []BatchItem{{ServiceMethod: "Foo.Sum", Args: Args{1, 2}, Reply: new(int)}}
+	err = client.Batch(context.Background(), items)
+	_assert(err == nil && ErrorCode(items[0].Error) == CodeResourceExhausted,
+		"expect batch item CodeResourceExhausted, but got %v, %v", err, items[0].Error)
+	ss, err := client.NewStream(context.Background(), "Stream.Echo")
+	_assert(err == nil, "failed to open stream: %v", err)
+	err = ss.Recv(new(string))
+	_assert(ErrorCode(err) == CodeResourceExhausted, "expect stream CodeResourceExhausted, but got %v", err)
+
+	close(gate)
+	time.Sleep(time.Millisecond * 50)
+	var reply int
+	err = client.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply)
+	_assert(err == nil && reply == 3, "slot should be released after the handler returns, but got %v", err)
+	err = client.Batch(context.Background(), items)
+	_assert(err == nil && items[0].Error == nil && *items[0].Reply.(*int) == 3, "batch item should succeed, but got %v", items[0].Error)
+}
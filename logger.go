@@ -0,0 +1,118 @@
+/**
+ * @Author : liangliangtoo
+ * @File : logger
+ * @Date: 2026/10/19 01:30
+ * @Description: 分级、带字段的日志接口，默认不输出
+ */
+package Trpc
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+/**
+使用方式：
+	server.Logger = Trpc.NewStdLogger(os.Stderr, Trpc.LevelInfo)
+	client, _ := Trpc.Dial("tcp", addr, &Trpc.Option{Logger: server.Logger})
+Server 与 Client 未设置 Logger 时不输出任何日志，也可以实现 Logger 接入其他日志库
+*/
+
+// Level 日志级别
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	default:
+		return "ERROR"
+	}
+}
+
+// Field 日志字段
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F 创建日志字段
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Logger 日志接口，需要支持并发调用
+type Logger interface {
+	Log(level Level, msg string, fields ...Field)
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Log(Level, string, ...Field) {}
+
+// 未设置 Logger 时使用
+var quiet Logger = nopLogger{}
+
+// StdLogger 以文本格式输出到 io.Writer：时间 级别 消息 key=value ...
+type StdLogger struct {
+	min Level
+	l   *log.Logger
+}
+
+// NewStdLogger 创建输出不低于 min 级别日志的 Logger
+func NewStdLogger(w io.Writer, min Level) *StdLogger {
+	return &StdLogger{min: min, l: log.New(w, "", log.LstdFlags)}
+}
+
+func (s *StdLogger) Log(level Level, msg string, fields ...Field) {
+	if level < s.min {
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for _, f := range fields {
+		v := fmt.Sprint(f.Value)
+		if strings.ContainsAny(v, " \t\n\"=") {
+			v = fmt.Sprintf("%q", v)
+		}
+		b.WriteByte(' ')
+		b.WriteString(f.Key)
+		b.WriteByte('=')
+		b.WriteString(v)
+	}
+	_ = s.l.Output(2, b.String())
+}
+
+func (s *Server) logger() Logger {
+	if s.Logger == nil {
+		return quiet
+	}
+	return s.Logger
+}
+
+func optionLogger(opt *Option) Logger {
+	if opt == nil || opt.Logger == nil {
+		return quiet
+	}
+	return opt.Logger
+}
+
+func (client *Client) logger() Logger {
+	return optionLogger(client.opt)
+}
@@ -0,0 +1,47 @@
+package Trpc
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestStdLogger(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	l := NewStdLogger(&buf, LevelInfo)
+	l.Log(LevelDebug, "hidden")
+	l.Log(LevelWarn, "rpc server: read header error", F("remote", "127.0.0.1:1"), F("err", "bad header"))
+	out := buf.String()
+	_assert(!strings.Contains(out, "hidden"), "debug logs should be filtered")
+	_assert(strings.Contains(out, `WARN rpc server: read header error remote=127.0.0.1:1 err="bad header"`),
+		"unexpected output %q", out)
+}
+
+// 记录日志的 Logger
+type memLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (m *memLogger) Log(level Level, msg string, fields ...Field) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lines = append(m.lines, level.String()+" "+msg)
+}
+
+func TestServer_Logger(t *testing.T) {
+	t.Parallel()
+
+	logger := new(memLogger)
+	server := NewServer()
+	server.Logger = logger
+	var foo Foo
+	_ = server.Register(&foo)
+	_assert(len(logger.lines) == 1 && logger.lines[0] == "DEBUG rpc server: register", "unexpected logs %v", logger.lines)
+
+	type unexported int
+	_assert(server.Register(new(unexported)) != nil, "unexported service should be rejected")
+}
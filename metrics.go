@@ -0,0 +1,311 @@
+/**
+ * @Author : liangliangtoo
+ * @File : metrics
+ * @Date: 2026/10/18 22:40
+ * @Description: Prometheus 文本格式的指标，不依赖第三方库
+ */
+package Trpc
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/**
+使用方式：
+	http.Handle("/metrics", server.MetricsHandler())
+HandleHTTP 不注册指标的路径，由使用方挂载到需要的位置
+服务端指标按 service/method 统计，客户端指标按 target（连接的远端地址）/method 统计，
+同一进程内所有 Client 的指标都会一起输出
+客户端指标最多保留 1000 个 target/method 组合，超出后合并到 target="other",method="other"
+*/
+
+// 延迟直方图的桶（秒）
+var latencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type histogram struct {
+	counts []uint64 // 落在每个桶内的数量（非累积），最后一个为 +Inf
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(latencyBuckets)+1)
+	}
+	v := d.Seconds()
+	i := sort.SearchFloat64s(latencyBuckets, v)
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// 一个方法或一个调用目标的统计
+type callMetrics struct {
+	inflight int64
+
+	mu        sync.Mutex
+	requests  uint64
+	errors    map[Code]uint64
+	lastError string
+	latency   histogram
+	recent    recentLatency // 调试页面使用的滑动窗口
+}
+
+// 开始处理
+func (m *callMetrics) begin() {
+	atomic.AddInt64(&m.inflight, 1)
+}
+
+// 处理结束
+func (m *callMetrics) end(err error, d time.Duration) {
+	atomic.AddInt64(&m.inflight, -1)
+	m.observe(err, d)
+}
+
+// 记录一次完成的调用
+func (m *callMetrics) observe(err error, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests++
+	m.latency.observe(d)
+	m.recent.add(time.Now(), d)
+	m.countError(err)
+}
+
+// 记录一次未执行就被拒绝的请求
+func (m *callMetrics) reject(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests++
+	m.countError(err)
+}
+
+// 需持有锁
+func (m *callMetrics) countError(err error) {
+	if err == nil {
+		return
+	}
+	if m.errors == nil {
+		m.errors = make(map[Code]uint64)
+	}
+	m.errors[ErrorCode(err)]++
+	m.lastError = err.Error()
+}
+
+// 统计快照
+type metricsSnapshot struct {
+	inflight int64
+	requests uint64
+	errors   map[Code]uint64
+	latency  histogram
+}
+
+func (m *callMetrics) snapshot() metricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := metricsSnapshot{
+		inflight: atomic.LoadInt64(&m.inflight),
+		requests: m.requests,
+		errors:   make(map[Code]uint64, len(m.errors)),
+		latency:  histogram{sum: m.latency.sum, count: m.latency.count},
+	}
+	for code, n := range m.errors {
+		s.errors[code] = n
+	}
+	s.latency.counts = append([]uint64(nil), m.latency.counts...)
+	return s
+}
+
+/** 客户端 **/
+
+type clientTarget struct {
+	target        string
+	serviceMethod string
+}
+
+// 客户端指标最多的 target/method 组合数，超出后新的组合合并到 overflowTarget
+const maxClientSeries = 1000
+
+// 合并后的 target 与 method 标签
+const overflowTarget = "other"
+
+// 按 target/method 统计的客户端指标，组合数有上限
+type clientRegistry struct {
+	sync.Mutex
+	limit   int
+	targets map[clientTarget]*callMetrics
+}
+
+func newClientRegistry(limit int) *clientRegistry {
+	return &clientRegistry{limit: limit, targets: make(map[clientTarget]*callMetrics)}
+}
+
+func (r *clientRegistry) get(target, serviceMethod string) *callMetrics {
+	key := clientTarget{target: target, serviceMethod: serviceMethod}
+
+	r.Lock()
+	defer r.Unlock()
+	m := r.targets[key]
+	if m != nil {
+		return m
+	}
+	// 保留一个位置给合并后的组合
+	if len(r.targets) >= r.limit-1 {
+		key = clientTarget{target: overflowTarget, serviceMethod: overflowTarget}
+		if m = r.targets[key]; m != nil {
+			return m
+		}
+	}
+	m = new(callMetrics)
+	r.targets[key] = m
+	return m
+}
+
+// 进程内所有 Client 的统计
+var clientMetrics = newClientRegistry(maxClientSeries)
+
+func clientMetricsFor(target, serviceMethod string) *callMetrics {
+	return clientMetrics.get(target, serviceMethod)
+}
+
+/** 输出 **/
+
+type metricsHTTP struct {
+	*Server
+}
+
+// MetricsHandler 返回以 Prometheus 文本格式输出指标的 http.Handler
+func (s *Server) MetricsHandler() http.Handler {
+	return metricsHTTP{s}
+}
+
+func (server metricsHTTP) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	server.writeMetrics(w)
+}
+
+// 带标签的一组统计
+type labeledMetrics struct {
+	labels  []string // name1, value1, name2, value2 ...
+	metrics metricsSnapshot
+}
+
+func (s *Server) writeMetrics(w io.Writer) {
+	var server []labeledMetrics
+	s.serviceMap.Range(func(namei, svci interface{}) bool {
+		for name, mtype := range svci.(*service).method {
+			server = append(server, labeledMetrics{
+				labels:  []string{"service", namei.(string), "method", name},
+				metrics: mtype.metrics.snapshot(),
+			})
+		}
+		return true
+	})
+
+	var client []labeledMetrics
+	clientMetrics.Lock()
+	for key, m := range clientMetrics.targets {
+		client = append(client, labeledMetrics{
+			labels:  []string{"target", key.target, "method", key.serviceMethod},
+			metrics: m.snapshot(),
+		})
+	}
+	clientMetrics.Unlock()
+
+	sortMetrics(server)
+	sortMetrics(client)
+
+	writeCounter(w, "trpc_server_requests_total", "Total number of requests received by the server.", server)
+	writeErrors(w, "trpc_server_errors_total", "Total number of failed requests by error code.", server)
+	writeHistogram(w, "trpc_server_request_duration_seconds", "Time spent in the handler.", server)
+	writeGauge(w, "trpc_server_in_flight", "Number of requests being handled.", server)
+
+	writeCounter(w, "trpc_client_requests_total", "Total number of calls made by clients.", client)
+	writeErrors(w, "trpc_client_errors_total", "Total number of failed calls by error code.", client)
+	writeHistogram(w, "trpc_client_request_duration_seconds", "Time from sending a call to receiving its reply.", client)
+}
+
+func sortMetrics(ms []labeledMetrics) {
+	sort.Slice(ms, func(i, j int) bool {
+		return strings.Join(ms[i].labels, "\x00") < strings.Join(ms[j].labels, "\x00")
+	})
+}
+
+// 格式化标签，extra 追加在末尾
+func formatLabels(labels []string, extra ...string) string {
+	labels = append(append([]string(nil), labels...), extra...)
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i])
+		b.WriteString(`="`)
+		b.WriteString(labelReplacer.Replace(labels[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeHeader(w io.Writer, name, help, typ string) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeCounter(w io.Writer, name, help string, ms []labeledMetrics) {
+	writeHeader(w, name, help, "counter")
+	for _, m := range ms {
+		_, _ = fmt.Fprintf(w, "%s%s %d\n", name, formatLabels(m.labels), m.metrics.requests)
+	}
+}
+
+func writeGauge(w io.Writer, name, help string, ms []labeledMetrics) {
+	writeHeader(w, name, help, "gauge")
+	for _, m := range ms {
+		_, _ = fmt.Fprintf(w, "%s%s %d\n", name, formatLabels(m.labels), m.metrics.inflight)
+	}
+}
+
+func writeErrors(w io.Writer, name, help string, ms []labeledMetrics) {
+	writeHeader(w, name, help, "counter")
+	for _, m := range ms {
+		codes := make([]Code, 0, len(m.metrics.errors))
+		for code := range m.metrics.errors {
+			codes = append(codes, code)
+		}
+		sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+		for _, code := range codes {
+			_, _ = fmt.Fprintf(w, "%s%s %d\n", name, formatLabels(m.labels, "code", code.String()), m.metrics.errors[code])
+		}
+	}
+}
+
+func writeHistogram(w io.Writer, name, help string, ms []labeledMetrics) {
+	writeHeader(w, name, help, "histogram")
+	for _, m := range ms {
+		h := m.metrics.latency
+		var cumulative uint64
+		for i, le := range latencyBuckets {
+			if h.counts != nil {
+				cumulative += h.counts[i]
+			}
+			_, _ = fmt.Fprintf(w, "%s_bucket%s %d\n", name,
+				formatLabels(m.labels, "le", strconv.FormatFloat(le, 'g', -1, 64)), cumulative)
+		}
+		_, _ = fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(m.labels, "le", "+Inf"), h.count)
+		_, _ = fmt.Fprintf(w, "%s_sum%s %s\n", name, formatLabels(m.labels), strconv.FormatFloat(h.sum, 'g', -1, 64))
+		_, _ = fmt.Fprintf(w, "%s_count%s %d\n", name, formatLabels(m.labels), h.count)
+	}
+}
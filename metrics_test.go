@@ -0,0 +1,59 @@
+package Trpc
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServer_MetricsHandler(t *testing.T) {
+	t.Parallel()
+
+	server := NewServer()
+	_ = server.Register(&Flaky{fails: map[string]int{"Get": 1}})
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+
+	client, _ := Dial("tcp", l.Addr().String())
+	defer func() { _ = client.Close() }()
+	var reply int
+	_ = client.Call(context.Background(), "Flaky.Get", 1, &reply)
+	_ = client.Call(context.Background(), "Flaky.Get", 1, &reply)
+
+	w := httptest.NewRecorder()
+	server.MetricsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+
+	target := l.Addr().String()
+	for _, line := range []string{
+		"# TYPE trpc_server_requests_total counter",
+		`trpc_server_requests_total{service="Flaky",method="Get"} 2`,
+		`trpc_server_requests_total{service="Flaky",method="Put"} 0`,
+		`trpc_server_errors_total{service="Flaky",method="Get",code="Unavailable"} 1`,
+		`trpc_server_request_duration_seconds_bucket{service="Flaky",method="Get",le="+Inf"} 2`,
+		`trpc_server_request_duration_seconds_count{service="Flaky",method="Get"} 2`,
+		`trpc_server_in_flight{service="Flaky",method="Get"} 0`,
+		`trpc_client_requests_total{target="` + target + `",method="Flaky.Get"} 2`,
+		`trpc_client_errors_total{target="` + target + `",method="Flaky.Get",code="Unavailable"} 1`,
+		`trpc_client_request_duration_seconds_count{target="` + target + `",method="Flaky.Get"} 2`,
+	} {
+		_assert(strings.Contains(body, line+"\n"), "missing metric %q in:\n%s", line, body)
+	}
+	_assert(formatLabels([]string{"a", "x\"y\\\n"}) == `{a="x\"y\\\n"}`, "label values should be escaped")
+}
+
+func TestClientRegistry(t *testing.T) {
+	t.Parallel()
+
+	r := newClientRegistry(3)
+	a := r.get("a", "Foo.Sum")
+	_assert(r.get("a", "Foo.Sum") == a, "same target and method should share metrics")
+	b := r.get("b", "Foo.Sum")
+	c := r.get("c", "Foo.Sum")
+	d := r.get("d", "Foo.Sum")
+	_assert(c == d && c != a && c != b, "series beyond the limit should be merged")
+	_, ok := r.targets[clientTarget{target: overflowTarget, serviceMethod: overflowTarget}]
+	_assert(ok && len(r.targets) == 3, "expect 3 series, but got %d", len(r.targets))
+}
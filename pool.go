@@ -0,0 +1,195 @@
+/**
+ * @Author : liangliangtoo
+ * @File : pool
+ * @Date: 2026/10/18 17:05
+ * @Description: 客户端连接池，每个地址维护多个连接
+ */
+package Trpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var ErrPoolExhausted = errors.New("rpc pool: too many connections")
+
+// PoolOption 连接池配置
+type PoolOption struct {
+	ConnsPerAddr int            // 每个地址最多的连接数，默认4
+	MaxConns     int            // 所有地址的连接总数上限，默认0代表不限制
+	DialOption   *Option        // 建立连接时使用的选项
+	Breaker      *BreakerOption // 非 nil 时为每个地址启用熔断
+	Hedge        *HedgeOption   // HedgedCall 使用的对冲配置，nil 时使用默认配置
+}
+
+// Pool 按 XDial 的地址格式（protocol@addr）维护连接
+// 单个 Client 的写操作由 sending 锁串行化，多个连接可以提高单个后端的吞吐
+type Pool struct {
+	opt      PoolOption
+	breakers *BreakerGroup // 未配置熔断时为 nil
+	hedges   *hedger
+	mu       sync.Mutex
+	clients  map[string][]*Client
+	dialing  map[string]int // 每个地址正在建立的连接，计入该地址的连接数
+	pending  int            // 所有地址正在建立的连接，计入总数
+	total    int
+	closed   bool
+}
+
+// NewPool 创建连接池，opt 为 nil 时使用默认配置
+func NewPool(opt *PoolOption) *Pool {
+	p := &Pool{clients: make(map[string][]*Client), dialing: make(map[string]int)}
+	if opt != nil {
+		p.opt = *opt
+	}
+	p.hedges = newHedger(p.opt.Hedge)
+	if p.opt.ConnsPerAddr <= 0 {
+		p.opt.ConnsPerAddr = 4
+	}
+	if p.opt.Breaker != nil {
+		p.breakers = NewBreakerGroup(p.opt.Breaker)
+	}
+	return p
+}
+
+// Get 返回 rpcAddr 上负载（未完成的请求数）最小的连接
+// 所有连接都繁忙且未达到上限时建立新连接
+func (p *Pool) Get(rpcAddr string) (*Client, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrShutdown
+	}
+
+	p.evict(rpcAddr)
+	clients := p.clients[rpcAddr]
+
+	var best *Client
+	bestLoad := 0
+	for _, client := range clients {
+		if load := client.numPending(); best == nil || load < bestLoad {
+			best, bestLoad = client, load
+		}
+	}
+
+	// 其他地址上已断开的连接同样占用总数，达到上限时先全部清理
+	if p.opt.MaxConns > 0 && p.total+p.pending >= p.opt.MaxConns {
+		for addr := range p.clients {
+			p.evict(addr)
+		}
+	}
+	full := len(clients)+p.dialing[rpcAddr] >= p.opt.ConnsPerAddr ||
+		(p.opt.MaxConns > 0 && p.total+p.pending >= p.opt.MaxConns)
+	if best != nil && (bestLoad == 0 || full) {
+		p.mu.Unlock()
+		return best, nil
+	}
+	if full {
+		p.mu.Unlock()
+		return nil, ErrPoolExhausted
+	}
+
+	// 建立连接时不持有锁，先占用一个名额
+	p.dialing[rpcAddr]++
+	p.pending++
+	p.mu.Unlock()
+
+	client, err := XDial(rpcAddr, p.opt.DialOption)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending--
+	if p.dialing[rpcAddr]--; p.dialing[rpcAddr] == 0 {
+		delete(p.dialing, rpcAddr)
+	}
+	if err != nil {
+		if best != nil {
+			return best, nil
+		}
+		return nil, err
+	}
+	if p.closed {
+		_ = client.Close()
+		return nil, ErrShutdown
+	}
+
+	p.clients[rpcAddr] = append(p.clients[rpcAddr], client)
+	p.total++
+	return client, nil
+}
+
+// 移除不可用的连接（需持有锁）
+func (p *Pool) evict(rpcAddr string) {
+	clients := p.clients[rpcAddr]
+	alive := clients[:0]
+	for _, client := range clients {
+		if client.IsAvailable() {
+			alive = append(alive, client)
+			continue
+		}
+		_ = client.Close()
+		p.total--
+	}
+
+	if len(alive) == 0 {
+		delete(p.clients, rpcAddr)
+		return
+	}
+	p.clients[rpcAddr] = alive
+}
+
+// Call 在 rpcAddr 负载最小的连接上调用，启用熔断时后端异常会快速失败
+func (p *Pool) Call(ctx context.Context, rpcAddr, serviceMethod string, args, reply interface{}) error {
+	if p.breakers == nil {
+		client, err := p.Get(rpcAddr)
+		if err != nil {
+			return err
+		}
+		return client.Call(ctx, serviceMethod, args, reply)
+	}
+
+	b := p.breakers.Get(rpcAddr)
+	generation, err := b.Allow()
+	if err != nil {
+		return err
+	}
+	client, err := p.Get(rpcAddr)
+	if errors.Is(err, ErrPoolExhausted) || errors.Is(err, ErrShutdown) {
+		// 连接池本地的错误与后端无关，不计入熔断；建立连接失败仍然计入
+		b.Cancel(generation)
+		return err
+	}
+	if err == nil {
+		err = client.Call(ctx, serviceMethod, args, reply)
+	}
+	b.Done(generation, err)
+	return err
+}
+
+// Breaker 返回地址对应的熔断器，未配置熔断时返回 nil
+func (p *Pool) Breaker(rpcAddr string) *Breaker {
+	if p.breakers == nil {
+		return nil
+	}
+	return p.breakers.Get(rpcAddr)
+}
+
+// Close 关闭所有连接
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrShutdown
+	}
+
+	p.closed = true
+	for addr, clients := range p.clients {
+		for _, client := range clients {
+			_ = client.Close()
+		}
+		delete(p.clients, addr)
+	}
+	p.total = 0
+	return nil
+}
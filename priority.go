@@ -0,0 +1,86 @@
+/**
+ * @Author : liangliangtoo
+ * @File : priority
+ * @Date: 2026/10/18 22:05
+ * @Description: 请求优先级，随请求头元数据传递，服务端按优先级调度排队的请求
+ */
+package Trpc
+
+import (
+	"context"
+
+	"github.com/LucienVen/Trpc/core"
+)
+
+/**
+使用方式：
+	ctx := Trpc.WithPriority(ctx, Trpc.PriorityBatch)
+	client.Call(ctx, "Backfill.Run", args, &reply)
+服务端的 Limiter 与 WorkerPool 优先执行高优先级的排队请求，
+处理函数的上下文同样携带优先级，继续调用下游服务时会沿用
+*/
+
+// 请求头元数据：请求的优先级
+const MetaPriority = "priority"
+
+// Priority 请求优先级，数值越大越优先
+type Priority int
+
+const (
+	PriorityBatch       Priority = -1 // 后台任务
+	PriorityNormal      Priority = 0  // 默认
+	PriorityInteractive Priority = 1  // 用户请求
+)
+
+var priorityNames = map[Priority]string{
+	PriorityBatch:       "batch",
+	PriorityNormal:      "normal",
+	PriorityInteractive: "interactive",
+}
+
+func (p Priority) String() string {
+	if name, ok := priorityNames[p]; ok {
+		return name
+	}
+	return priorityNames[PriorityNormal]
+}
+
+// 解析元数据中的优先级，无法识别时为 PriorityNormal
+func parsePriority(name string) Priority {
+	for p, n := range priorityNames {
+		if n == name {
+			return p
+		}
+	}
+	return PriorityNormal
+}
+
+type priorityKey struct{}
+
+// WithPriority 返回携带优先级的上下文，Client.Call 会将其写入请求头
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFromContext 返回上下文中的优先级，未设置时为 PriorityNormal
+func PriorityFromContext(ctx context.Context) Priority {
+	p, _ := ctx.Value(priorityKey{}).(Priority)
+	return p
+}
+
+// 请求头中的优先级
+func headerPriority(h *core.Header) Priority {
+	if h.Meta == nil {
+		return PriorityNormal
+	}
+	return parsePriority(h.Meta[MetaPriority])
+}
+
+// 上下文中的优先级对应的请求头元数据，默认优先级不写入
+func priorityMeta(ctx context.Context) map[string]string {
+	p := PriorityFromContext(ctx)
+	if p == PriorityNormal {
+		return nil
+	}
+	return map[string]string{MetaPriority: p.String()}
+}
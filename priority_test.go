@@ -0,0 +1,54 @@
+package Trpc
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+type Lane int
+
+func (l Lane) Get(ctx context.Context, args int, reply *string) error {
+	*reply = PriorityFromContext(ctx).String()
+	return nil
+}
+
+// 记录单向调用的优先级
+type Seen chan string
+
+func (s Seen) Put(ctx context.Context, args int, reply *int) error {
+	s <- PriorityFromContext(ctx).String()
+	return nil
+}
+
+func TestClient_priority(t *testing.T) {
+	t.Parallel()
+
+	server := NewServer()
+	_ = server.Register(new(Lane))
+	seen := make(Seen, 1)
+	_ = server.Register(seen)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+
+	client, _ := Dial("tcp", l.Addr().String())
+	defer func() { _ = client.Close() }()
+
+	var reply string
+	_ = client.Call(context.Background(), "Lane.Get", 1, &reply)
+	_assert(reply == "normal", "expect normal priority by default, but got %s", reply)
+
+	ctx := WithPriority(context.Background(), PriorityBatch)
+	_ = client.Call(ctx, "Lane.Get", 1, &reply)
+	_assert(reply == "batch", "priority should be passed to the handler, but got %s", reply)
+
+	// 异步调用与单向调用同样携带优先级
+	call := <-client.GoContext(ctx, "Lane.Get", 1, &reply, nil).Done
+	_assert(call.Error == nil && reply == "batch", "GoContext should pass priority, but got %s", reply)
+	_ = client.NotifyContext(ctx, "Seen.Put", 1)
+	_assert(<-seen == "batch", "NotifyContext should pass priority")
+	items := []BatchItem{{ServiceMethod: "Lane.Get", Args: 1, Reply: &reply}}
+	err := client.Batch(WithPriority(ctx, PriorityInteractive), items)
+	_assert(err == nil && items[0].Error == nil && reply == "interactive", "Batch should pass priority, but got %s", reply)
+	_assert(parsePriority("unknown") == PriorityNormal, "unknown priority should be normal")
+}
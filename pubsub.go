@@ -0,0 +1,245 @@
+/**
+ * @Author : liangliangtoo
+ * @File : pubsub
+ * @Date: 2026/10/18 15:10
+ * @Description: 内置的发布/订阅服务，可注册在任意 Server 上
+ */
+package Trpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+/**
+使用方式：
+	server.Register(Trpc.NewPubSub(nil))
+	sub, _ := client.Subscribe(ctx, Trpc.SubscribeArgs{Topics: []string{"config"}})
+	client.Call(ctx, "PubSub.Publish", Trpc.Message{Topic: "config", Data: data}, &delivered)
+订阅通过服务端流推送消息，每个订阅者拥有独立的缓冲区
+服务端登记订阅后先发送一条确认，client.Subscribe 收到确认才返回，之后发布的消息不会丢失
+*/
+
+// OverflowPolicy 订阅者缓冲区满时的处理策略
+type OverflowPolicy int
+
+const (
+	PolicyDefault OverflowPolicy = iota // 使用 PubSubOption 中的策略，仍未设置时为 PolicyDrop
+	PolicyDrop                          // 丢弃新消息，不阻塞发布者
+	PolicyBlock                         // 阻塞发布者，直到缓冲区有空位或订阅结束
+)
+
+// 默认的订阅者缓冲区大小
+const defaultSubscriberBuffer = 64
+
+// 默认的订阅者缓冲区上限
+const defaultMaxSubscriberBuffer = 4096
+
+// Message 发布到主题的消息，Data 的编码由使用方约定
+type Message struct {
+	Topic string
+	Data  []byte
+}
+
+// SubscribeArgs 订阅参数，BufferSize/Policy 为零值时使用 PubSub 的默认配置
+type SubscribeArgs struct {
+	Topics     []string
+	BufferSize int
+	Policy     OverflowPolicy
+}
+
+// PubSubOption PubSub 的默认配置
+type PubSubOption struct {
+	BufferSize    int
+	MaxBufferSize int // 订阅者可以申请的缓冲区上限，默认4096，超出时订阅失败
+	Policy        OverflowPolicy
+}
+
+// 单个订阅者
+type subscriber struct {
+	ch      chan *Message
+	policy  OverflowPolicy
+	done    chan struct{}
+	dropped uint64 // 因缓冲区满被丢弃的消息数量
+}
+
+// PubSub 发布/订阅服务，服务名为 PubSub
+type PubSub struct {
+	opt    PubSubOption
+	mu     sync.RWMutex
+	topics map[string]map[*subscriber]struct{}
+}
+
+// NewPubSub 创建发布/订阅服务，opt 为 nil 时使用默认配置
+func NewPubSub(opt *PubSubOption) *PubSub {
+	ps := &PubSub{topics: make(map[string]map[*subscriber]struct{})}
+	if opt != nil {
+		ps.opt = *opt
+	}
+	if ps.opt.BufferSize <= 0 {
+		ps.opt.BufferSize = defaultSubscriberBuffer
+	}
+	if ps.opt.MaxBufferSize <= 0 {
+		ps.opt.MaxBufferSize = defaultMaxSubscriberBuffer
+	}
+	if ps.opt.BufferSize > ps.opt.MaxBufferSize {
+		ps.opt.BufferSize = ps.opt.MaxBufferSize
+	}
+	return ps
+}
+
+// Publish 发布消息，reply 为成功投递的订阅者数量
+func (ps *PubSub) Publish(msg Message, reply *int) error {
+	if msg.Topic == "" {
+		return errors.New("rpc pubsub: empty topic")
+	}
+
+	ps.mu.RLock()
+	subs := make([]*subscriber, 0, len(ps.topics[msg.Topic]))
+	for sub := range ps.topics[msg.Topic] {
+		subs = append(subs, sub)
+	}
+	ps.mu.RUnlock()
+
+	delivered := 0
+	for _, sub := range subs {
+		if sub.deliver(&msg) {
+			delivered++
+		}
+	}
+	*reply = delivered
+	return nil
+}
+
+// Subscribe 服务端流：先接收一条 SubscribeArgs，然后持续推送匹配主题的消息
+func (ps *PubSub) Subscribe(stream *ServerStream) error {
+	var args SubscribeArgs
+	if err := stream.Recv(&args); err != nil {
+		return err
+	}
+	if len(args.Topics) == 0 {
+		return errors.New("rpc pubsub: no topics to subscribe")
+	}
+	// 缓冲区大小来自客户端，需要限制
+	if args.BufferSize < 0 || args.BufferSize > ps.opt.MaxBufferSize {
+		return Errorf(CodeInvalidArgument, "rpc pubsub: buffer size %d out of range [0, %d]", args.BufferSize, ps.opt.MaxBufferSize)
+	}
+
+	sub := &subscriber{policy: args.Policy, done: make(chan struct{})}
+	if sub.policy == PolicyDefault {
+		sub.policy = ps.opt.Policy
+	}
+	size := args.BufferSize
+	if size <= 0 {
+		size = ps.opt.BufferSize
+	}
+	sub.ch = make(chan *Message, size)
+
+	ps.subscribe(sub, args.Topics)
+	defer ps.unsubscribe(sub, args.Topics)
+
+	// 确认订阅已生效，内容为订阅的主题数量
+	if err := stream.Send(len(args.Topics)); err != nil {
+		return err
+	}
+
+	ctx := stream.Context()
+	for {
+		select {
+		case msg := <-sub.ch:
+			if err := stream.Send(msg); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (ps *PubSub) subscribe(sub *subscriber, topics []string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for _, topic := range topics {
+		if ps.topics[topic] == nil {
+			ps.topics[topic] = make(map[*subscriber]struct{})
+		}
+		ps.topics[topic][sub] = struct{}{}
+	}
+}
+
+func (ps *PubSub) unsubscribe(sub *subscriber, topics []string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for _, topic := range topics {
+		delete(ps.topics[topic], sub)
+		if len(ps.topics[topic]) == 0 {
+			delete(ps.topics, topic)
+		}
+	}
+	close(sub.done)
+}
+
+// 按订阅者的策略投递消息，返回是否投递成功
+func (sub *subscriber) deliver(msg *Message) bool {
+	if sub.policy == PolicyBlock {
+		select {
+		case sub.ch <- msg:
+			return true
+		case <-sub.done:
+			return false
+		}
+	}
+
+	select {
+	case sub.ch <- msg:
+		return true
+	default:
+		atomic.AddUint64(&sub.dropped, 1)
+		return false
+	}
+}
+
+/** 客户端 **/
+
+// Subscription 客户端的订阅，结束订阅时取消 Subscribe 传入的 ctx 或调用 Close
+type Subscription struct {
+	stream *ClientStream
+	cancel context.CancelFunc
+}
+
+// Subscribe 订阅服务端 PubSub 服务的主题，服务端确认订阅生效后返回
+func (client *Client) Subscribe(ctx context.Context, args SubscribeArgs) (*Subscription, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := client.NewStream(ctx, "PubSub.Subscribe")
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	if err = stream.Send(args); err != nil {
+		cancel()
+		return nil, err
+	}
+	var topics int
+	if err = stream.Recv(&topics); err != nil {
+		cancel()
+		return nil, err
+	}
+	return &Subscription{stream: stream, cancel: cancel}, nil
+}
+
+// Next 阻塞等待下一条消息
+func (sub *Subscription) Next() (*Message, error) {
+	var msg Message
+	if err := sub.stream.Recv(&msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// Close 结束订阅
+func (sub *Subscription) Close() {
+	sub.cancel()
+}
@@ -0,0 +1,64 @@
+/**
+ * @Author : liangliangtoo
+ * @File : pubsub_test
+ * @Date: 2026/10/18 15:42
+ * @Description:
+ */
+package Trpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPubSub(t *testing.T) {
+	t.Parallel()
+
+	server := NewServer()
+	_ = server.Register(NewPubSub(nil))
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+
+	client, _ := Dial("tcp", l.Addr().String())
+	defer func() { _ = client.Close() }()
+
+	sub, err := client.Subscribe(context.Background(), SubscribeArgs{Topics: []string{"config"}})
+	_assert(err == nil, "failed to subscribe: %v", err)
+	defer sub.Close()
+
+	publish := func(topic, data string) int {
+		var delivered int
+		err := client.Call(context.Background(), "PubSub.Publish", Message{Topic: topic, Data: []byte(data)}, &delivered)
+		_assert(err == nil, "failed to publish: %v", err)
+		return delivered
+	}
+	// Subscribe 返回时订阅已经生效
+	_assert(publish("config", "v1") == 1, "subscription should be active once Subscribe returns")
+	_assert(publish("other", "x") == 0, "unexpected delivery to other topic")
+
+	msg, err := sub.Next()
+	_assert(err == nil && msg.Topic == "config" && string(msg.Data) == "v1", "unexpected message %v (%v)", msg, err)
+
+	// 客户端指定的缓冲区过大时订阅失败，不能让服务端崩溃
+	_, err = client.Subscribe(context.Background(), SubscribeArgs{Topics: []string{"config"}, BufferSize: 1 << 62})
+	_assert(ErrorCode(err) == CodeInvalidArgument, "expect CodeInvalidArgument, but got %v", err)
+	_assert(client.IsAvailable(), "client should be available")
+}
+
+func TestSubscriber_deliver(t *testing.T) {
+	drop := &subscriber{ch: make(chan *Message, 1), policy: PolicyDrop, done: make(chan struct{})}
+	_assert(drop.deliver(&Message{}) && !drop.deliver(&Message{}), "drop policy should drop when full")
+	_assert(drop.dropped == 1, "expect 1 dropped message, but got %d", drop.dropped)
+
+	block := &subscriber{ch: make(chan *Message, 1), policy: PolicyBlock, done: make(chan struct{})}
+	_assert(block.deliver(&Message{}), "failed to deliver")
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		<-block.ch
+	}()
+	_assert(block.deliver(&Message{}), "block policy should wait for room")
+	close(block.done)
+	_assert(!block.deliver(&Message{}), "block policy should give up after unsubscribe")
+}
@@ -0,0 +1,176 @@
+/**
+ * @Author : liangliangtoo
+ * @File : ratelimit
+ * @Date: 2026/10/18 20:55
+ * @Description: 按方法与调用方身份的令牌桶限流
+ */
+package Trpc
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+/**
+使用方式：
+	server.RateLimiter = Trpc.NewRateLimiter(&Trpc.RateLimitOption{
+		Methods:   map[string]Trpc.RateLimit{"Search.Query": {Rate: 100, Burst: 20}},
+		PerClient: &Trpc.RateLimit{Rate: 10, Burst: 10},
+	})
+调用方身份为 Server.Authenticate 返回的主体，未设置时为连接的远端地址（不含端口）
+被限流的请求回复 CodeResourceExhausted，响应头的元数据 MetaRetryAfter 给出建议的等待时间
+普通调用、单向调用、批量调用中的每个请求与流的打开各消耗一个令牌，流中的消息不计入
+批量中被限流的请求只有自身失败，错误同样携带 MetaRetryAfter
+*/
+
+// 响应头元数据：被限流时建议的等待时间，格式同 time.Duration.String
+const MetaRetryAfter = "retry-after"
+
+// RateLimit 令牌桶参数
+type RateLimit struct {
+	Rate  float64 // 每秒产生的令牌数
+	Burst int     // 桶的容量，默认为 Rate 向上取整
+}
+
+// RateLimitOption 限流配置，两类限制同时生效
+type RateLimitOption struct {
+	Methods   map[string]RateLimit // 单个方法（Service.Method）的总速率
+	PerClient *RateLimit           // 每个调用方的速率，nil 代表不限制
+}
+
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(limit RateLimit, now time.Time) *bucket {
+	burst := float64(limit.Burst)
+	if burst <= 0 {
+		burst = math.Ceil(limit.Rate)
+	}
+	return &bucket{rate: limit.Rate, burst: burst, tokens: burst, last: now}
+}
+
+// 补充令牌，返回获得一个令牌需要等待的时间
+func (b *bucket) wait(now time.Time) time.Duration {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// 桶已经补满，可以丢弃
+func (b *bucket) idle(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+// RateLimiter 服务端的限流器，在找到服务方法之后、执行之前检查
+type RateLimiter struct {
+	opt RateLimitOption
+
+	mu      sync.Mutex
+	methods map[string]*bucket
+	clients map[string]*bucket
+	swept   time.Time
+}
+
+// NewRateLimiter 创建限流器，Rate 不大于0的限制会被忽略
+func NewRateLimiter(opt *RateLimitOption) *RateLimiter {
+	r := &RateLimiter{
+		methods: make(map[string]*bucket),
+		clients: make(map[string]*bucket),
+		swept:   time.Now(),
+	}
+	if opt == nil {
+		return r
+	}
+
+	r.opt.Methods = make(map[string]RateLimit)
+	for method, limit := range opt.Methods {
+		if limit.Rate > 0 {
+			r.opt.Methods[method] = limit
+		}
+	}
+	if opt.PerClient != nil && opt.PerClient.Rate > 0 {
+		limit := *opt.PerClient
+		r.opt.PerClient = &limit
+	}
+	return r
+}
+
+// 两个令牌桶都有令牌时才放行，否则返回需要等待的时间
+func (r *RateLimiter) allow(identity, method string) (time.Duration, bool) {
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sweep(now)
+
+	var buckets []*bucket
+	if limit, ok := r.opt.Methods[method]; ok {
+		b := r.methods[method]
+		if b == nil {
+			b = newBucket(limit, now)
+			r.methods[method] = b
+		}
+		buckets = append(buckets, b)
+	}
+	if r.opt.PerClient != nil {
+		b := r.clients[identity]
+		if b == nil {
+			b = newBucket(*r.opt.PerClient, now)
+			r.clients[identity] = b
+		}
+		buckets = append(buckets, b)
+	}
+
+	var wait time.Duration
+	for _, b := range buckets {
+		if d := b.wait(now); d > wait {
+			wait = d
+		}
+	}
+	if wait > 0 {
+		return wait, false
+	}
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return 0, true
+}
+
+// 定期清理已补满的调用方令牌桶，避免调用方很多时内存持续增长（需持有锁）
+func (r *RateLimiter) sweep(now time.Time) {
+	if now.Sub(r.swept) < time.Minute {
+		return
+	}
+	r.swept = now
+	for identity, b := range r.clients {
+		if b.idle(now) {
+			delete(r.clients, identity)
+		}
+	}
+}
+
+// 限流时返回的错误
+func rateLimitError(method string, wait time.Duration) *Error {
+	err := Errorf(CodeResourceExhausted, "rpc server: rate limit exceeded: %s", method)
+	err.Meta = map[string]string{MetaRetryAfter: wait.String()}
+	return err
+}
+
+// RetryAfter 返回被限流时服务端建议的等待时间，没有建议时返回0
+func RetryAfter(err error) time.Duration {
+	var e *Error
+	if !errors.As(err, &e) || e.Meta == nil {
+		return 0
+	}
+	d, _ := time.ParseDuration(e.Meta[MetaRetryAfter])
+	return d
+}
@@ -0,0 +1,91 @@
+package Trpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	t.Parallel()
+
+	r := NewRateLimiter(&RateLimitOption{
+		Methods:   map[string]RateLimit{"Foo.Sum": {Rate: 100, Burst: 2}},
+		PerClient: &RateLimit{Rate: 1000, Burst: 3},
+	})
+	_, ok1 := r.allow("a", "Foo.Sum")
+	_, ok2 := r.allow("b", "Foo.Sum")
+	wait, ok3 := r.allow("c", "Foo.Sum")
+	_assert(ok1 && ok2 && !ok3, "method bucket should be shared by all clients")
+	_assert(wait > 0 && wait <= time.Millisecond*10, "unexpected wait %s", wait)
+
+	_, ok := r.allow("a", "Foo.Sleep")
+	_assert(ok, "methods without limit should only use the client bucket")
+	_, ok = r.allow("a", "Foo.Sleep")
+	_, ok = r.allow("a", "Foo.Sleep")
+	_assert(!ok, "client bucket should be exhausted")
+
+	time.Sleep(time.Millisecond * 20)
+	_, ok = r.allow("c", "Foo.Sum")
+	_assert(ok, "tokens should be refilled")
+}
+
+func TestServer_RateLimiter(t *testing.T) {
+	t.Parallel()
+
+	server := NewServer()
+	server.RateLimiter = NewRateLimiter(&RateLimitOption{PerClient: &RateLimit{Rate: 1, Burst: 1}})
+	server.Authenticate = func(remoteAddr, credential string) (string, error) {
+		if credential == "" {
+			return "", errors.New("missing credential")
+		}
+		return credential, nil
+	}
+	var foo Foo
+	_ = server.Register(&foo)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+
+	ctx := context.Background()
+	var reply int
+	alice, _ := Dial("tcp", l.Addr().String(), &Option{Credential: "alice"})
+	defer func() { _ = alice.Close() }()
+	_assert(alice.Call(ctx, "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply) == nil, "first call should pass")
+	err := alice.Call(ctx, "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_assert(ErrorCode(err) == CodeResourceExhausted, "expect CodeResourceExhausted, but got %v", err)
+	_assert(RetryAfter(err) > 0, "expect a retry-after hint")
+
+	// 另一个连接使用相同的主体，共享令牌桶
+	again, _ := Dial("tcp", l.Addr().String(), &Option{Credential: "alice"})
+	defer func() { _ = again.Close() }()
+	err = again.Call(ctx, "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_assert(ErrorCode(err) == CodeResourceExhausted, "same principal should share the limit, but got %v", err)
+
+	bob, _ := Dial("tcp", l.Addr().String(), &Option{Credential: "bob"})
+	defer func() { _ = bob.Close() }()
+	_assert(bob.Call(ctx, "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply) == nil, "other principals should not be limited")
+
+	// 批量中的每个请求各消耗一个令牌
+	carol, _ := Dial("tcp", l.Addr().String(), &Option{Credential: "carol"})
+	defer func() { _ = carol.Close() }()
+	items := []BatchItem{
+		{ServiceMethod: "Foo.Sum", Args: Args{Num1: 1, Num2: 2}, Reply: new(int)},
+		{ServiceMethod: "Foo.Sum", Args: Args{Num1: 3, Num2: 4}, Reply: new(int)},
+	}
+	err = carol.Batch(ctx, items)
+	_assert(err == nil, "batch should not fail as a whole, but got %v", err)
+	limited := 0
+	for _, item := range items {
+		if ErrorCode(item.Error) == CodeResourceExhausted && RetryAfter(item.Error) > 0 {
+			limited++
+		}
+	}
+	_assert(limited == 1, "expect one limited batch item, but got %d", limited)
+
+	anonymous, _ := Dial("tcp", l.Addr().String())
+	defer func() { _ = anonymous.Close() }()
+	err = anonymous.Call(ctx, "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_assert(ErrorCode(err) == CodeUnavailable, "unauthenticated connection should be closed, but got %v", err)
+}
@@ -0,0 +1,255 @@
+/**
+ * @Author : liangliangtoo
+ * @File : reconnect
+ * @Date: 2026/10/18 16:30
+ * @Description: 自动重连的客户端
+ */
+package Trpc
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var ErrReconnecting = errors.New("rpc client: reconnecting")
+
+var ErrReconnectQueueFull = errors.New("rpc client: too many calls waiting for reconnection")
+
+// ReconnectOption 重连配置
+type ReconnectOption struct {
+	MinBackoff time.Duration // 第一次重连前的等待时间，默认100ms
+	MaxBackoff time.Duration // 等待时间上限，默认10s
+	Jitter     float64       // 等待时间的随机浮动比例（0~1），默认0.2
+	FailFast   bool          // 重连期间的调用立即返回 ErrReconnecting
+	QueueSize  int           // 重连期间最多等待的调用数量，超出时返回 ErrReconnectQueueFull，默认100
+}
+
+var DefaultReconnectOption = &ReconnectOption{
+	MinBackoff: time.Millisecond * 100,
+	MaxBackoff: time.Second * 10,
+	Jitter:     0.2,
+	QueueSize:  100,
+}
+
+// ReconnectingClient 在连接断开（receive 退出）后按指数退避重新连接
+type ReconnectingClient struct {
+	rpcAddr string // 格式同 XDial：protocol@addr
+	opts    []*Option
+	ropt    ReconnectOption
+	logger  Logger
+
+	mu      sync.Mutex
+	client  *Client
+	ready   chan struct{} // 连接可用时关闭，断开后替换为新的 chan
+	down    bool          // 当前连接已断开，ready 尚未关闭
+	waiting int           // 等待重连的调用数量
+	closed  bool
+	closeCh chan struct{}
+}
+
+// NewReconnectingClient 连接 rpcAddr，第一次连接失败时直接返回错误
+func NewReconnectingClient(rpcAddr string, ropt *ReconnectOption, opts ...*Option) (*ReconnectingClient, error) {
+	client, err := XDial(rpcAddr, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	rc := &ReconnectingClient{
+		rpcAddr: rpcAddr,
+		opts:    opts,
+		ropt:    parseReconnectOption(ropt),
+		logger:  client.logger(),
+		client:  client,
+		ready:   make(chan struct{}),
+		closeCh: make(chan struct{}),
+	}
+	close(rc.ready)
+
+	go rc.watch(client)
+	return rc, nil
+}
+
+func parseReconnectOption(ropt *ReconnectOption) ReconnectOption {
+	if ropt == nil {
+		return *DefaultReconnectOption
+	}
+
+	opt := *ropt
+	if opt.MinBackoff <= 0 {
+		opt.MinBackoff = DefaultReconnectOption.MinBackoff
+	}
+	if opt.MaxBackoff < opt.MinBackoff {
+		opt.MaxBackoff = DefaultReconnectOption.MaxBackoff
+	}
+	if opt.Jitter < 0 || opt.Jitter > 1 {
+		opt.Jitter = DefaultReconnectOption.Jitter
+	}
+	if opt.QueueSize <= 0 {
+		opt.QueueSize = DefaultReconnectOption.QueueSize
+	}
+	return opt
+}
+
+// 等待连接断开后重连，直到 Close
+func (rc *ReconnectingClient) watch(client *Client) {
+	for {
+		select {
+		case <-client.done:
+		case <-rc.closeCh:
+			return
+		}
+
+		rc.mu.Lock()
+		rc.markDown()
+		rc.mu.Unlock()
+
+		client = rc.redial()
+		if client == nil {
+			return
+		}
+
+		rc.mu.Lock()
+		if rc.closed {
+			rc.mu.Unlock()
+			_ = client.Close()
+			return
+		}
+		client.inheritIdempotent(rc.client)
+		rc.client = client
+		rc.down = false
+		close(rc.ready)
+		rc.mu.Unlock()
+	}
+}
+
+// 标记连接已断开并替换 ready（需持有锁）
+// get 可能先于 watch 发现连接断开，由先发现的一方替换，避免 get 在已关闭的 ready 上空转
+func (rc *ReconnectingClient) markDown() {
+	if !rc.down {
+		rc.down = true
+		rc.ready = make(chan struct{})
+	}
+}
+
+// 按指数退避与随机浮动重新连接，Close 后返回 nil
+func (rc *ReconnectingClient) redial() *Client {
+	backoff := rc.ropt.MinBackoff
+	for {
+		wait := time.Duration(float64(backoff) * (1 + rc.ropt.Jitter*(2*rand.Float64()-1)))
+		select {
+		case <-time.After(wait):
+		case <-rc.closeCh:
+			return nil
+		}
+
+		client, err := XDial(rc.rpcAddr, rc.opts...)
+		if err == nil {
+			return client
+		}
+		rc.logger.Log(LevelWarn, "rpc client: reconnect error",
+			F("addr", rc.rpcAddr), F("err", err), F("retryAfter", backoff))
+
+		backoff *= 2
+		if backoff > rc.ropt.MaxBackoff {
+			backoff = rc.ropt.MaxBackoff
+		}
+	}
+}
+
+// 获取可用的连接，重连期间按配置等待或立即失败
+func (rc *ReconnectingClient) get(ctx context.Context) (*Client, error) {
+	queued := false
+	defer func() {
+		if queued {
+			rc.mu.Lock()
+			rc.waiting--
+			rc.mu.Unlock()
+		}
+	}()
+
+	for {
+		rc.mu.Lock()
+		if rc.closed {
+			rc.mu.Unlock()
+			return nil, ErrShutdown
+		}
+		if rc.client.IsAvailable() {
+			client := rc.client
+			rc.mu.Unlock()
+			return client, nil
+		}
+		if rc.ropt.FailFast {
+			rc.mu.Unlock()
+			return nil, ErrReconnecting
+		}
+		if !queued {
+			if rc.waiting >= rc.ropt.QueueSize {
+				rc.mu.Unlock()
+				return nil, ErrReconnectQueueFull
+			}
+			rc.waiting++
+			queued = true
+		}
+		rc.markDown()
+		ready := rc.ready
+		rc.mu.Unlock()
+
+		select {
+		case <-ready:
+		case <-rc.closeCh:
+			return nil, ErrShutdown
+		case <-ctx.Done():
+			return nil, contextError("rpc client: call failed", ctx)
+		}
+	}
+}
+
+// Call 与 Client.Call 相同，连接断开时等待重连或立即失败
+// 配置了 Option.Retry 时，每次重试都使用重连后的连接
+func (rc *ReconnectingClient) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	rc.mu.Lock()
+	retry := rc.client.opt.Retry
+	rc.mu.Unlock()
+
+	attempt := func() error {
+		client, err := rc.get(ctx)
+		if err != nil {
+			return err
+		}
+		return client.call(ctx, serviceMethod, args, reply)
+	}
+	if retry == nil {
+		return attempt()
+	}
+	return retry.do(ctx, serviceMethod, rc.IsIdempotent, attempt)
+}
+
+// IsIdempotent 同 Client.IsIdempotent
+func (rc *ReconnectingClient) IsIdempotent(serviceMethod string) bool {
+	rc.mu.Lock()
+	client := rc.client
+	rc.mu.Unlock()
+	return client.IsIdempotent(serviceMethod)
+}
+
+// IsAvailable 当前连接是否可用
+func (rc *ReconnectingClient) IsAvailable() bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return !rc.closed && rc.client.IsAvailable()
+}
+
+// Close 关闭当前连接并停止重连
+func (rc *ReconnectingClient) Close() error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.closed {
+		return ErrShutdown
+	}
+	rc.closed = true
+	close(rc.closeCh)
+	return rc.client.Close()
+}
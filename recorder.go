@@ -0,0 +1,163 @@
+/**
+ * @Author : liangliangtoo
+ * @File : recorder
+ * @Date: 2026/10/19 03:40
+ * @Description: 录制服务端收到的请求，供 cmd/trpcreplay 回放
+ */
+package Trpc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/LucienVen/Trpc/core"
+)
+
+/**
+使用方式：
+	recorder, _ := Trpc.OpenRecorder("traffic.jsonl", &Trpc.RecordOption{SampleRate: 0.01})
+	server.Recorder = recorder
+	defer recorder.Close()
+回放：
+	trpcreplay -addr tcp@canary:9999 -file traffic.jsonl -rate 100 -concurrency 8
+普通调用与单向调用各录制一行，参数与响应编码为 JSON；流与批量调用不录制
+*/
+
+// RecordedCall 录制的一次请求
+type RecordedCall struct {
+	Time          time.Time         `json:"time"`
+	ServiceMethod string            `json:"method"`
+	Notify        bool              `json:"notify,omitempty"` // 单向调用
+	Meta          map[string]string `json:"meta,omitempty"`   // 请求头的元数据
+	Args          json.RawMessage   `json:"args"`
+	Reply         json.RawMessage   `json:"reply,omitempty"` // 处理函数返回错误或单向调用时为空
+	Code          string            `json:"code"`
+	Error         string            `json:"error,omitempty"`
+}
+
+// Context 返回携带录制时优先级的上下文，trace 上下文不会沿用
+func (rc *RecordedCall) Context(ctx context.Context) context.Context {
+	if p, ok := rc.Meta[MetaPriority]; ok {
+		return WithPriority(ctx, parsePriority(p))
+	}
+	return ctx
+}
+
+// RecordOption 录制配置
+type RecordOption struct {
+	SampleRate float64  // 采样率（0~1），默认0代表全部录制
+	Methods    []string // 只录制这些 "Service.Method"，默认为空代表全部录制
+}
+
+var DefaultRecordOption = &RecordOption{}
+
+func parseRecordOption(opt *RecordOption) RecordOption {
+	if opt == nil {
+		opt = DefaultRecordOption
+	}
+
+	o := *opt
+	if o.SampleRate < 0 || o.SampleRate > 1 {
+		o.SampleRate = DefaultRecordOption.SampleRate
+	}
+	return o
+}
+
+// Recorder 将请求写为 JSON 行，需要服务端的参数与响应类型可以编码为 JSON
+type Recorder struct {
+	opt     RecordOption
+	methods map[string]bool
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewRecorder 将录制的请求写入 w，opt 为 nil 时使用默认配置
+func NewRecorder(w io.Writer, opt *RecordOption) *Recorder {
+	r := &Recorder{opt: parseRecordOption(opt), w: w}
+	if len(r.opt.Methods) > 0 {
+		r.methods = make(map[string]bool, len(r.opt.Methods))
+		for _, m := range r.opt.Methods {
+			r.methods[m] = true
+		}
+	}
+	return r
+}
+
+// OpenRecorder 将录制的请求追加写入文件
+func OpenRecorder(path string, opt *RecordOption) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return NewRecorder(f, opt), nil
+}
+
+// 处理函数执行前编码参数，处理函数可能修改参数；未采样时返回 nil
+func (r *Recorder) begin(req *request) (*RecordedCall, error) {
+	if r == nil {
+		return nil, nil
+	}
+	if r.methods != nil && !r.methods[req.h.ServiceMethod] {
+		return nil, nil
+	}
+	if r.opt.SampleRate > 0 && rand.Float64() >= r.opt.SampleRate {
+		return nil, nil
+	}
+
+	args, err := json.Marshal(req.argv.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return &RecordedCall{
+		Time:          req.start,
+		ServiceMethod: req.h.ServiceMethod,
+		Notify:        req.h.Kind == core.KindNotify,
+		Meta:          req.meta,
+		Args:          args,
+	}, nil
+}
+
+// 处理函数执行后编码响应并写出
+func (r *Recorder) end(rc *RecordedCall, replyv reflect.Value, err error) error {
+	if rc == nil {
+		return nil
+	}
+
+	rc.Code = ErrorCode(err).String()
+	if err != nil {
+		rc.Error = err.Error()
+	} else if !rc.Notify {
+		reply, err := json.Marshal(replyv.Interface())
+		if err != nil {
+			return err
+		}
+		rc.Reply = reply
+	}
+
+	line, err := json.Marshal(rc)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err = r.w.Write(append(line, '\n'))
+	return err
+}
+
+// Close 关闭底层的 io.Writer（如果可以关闭）
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, ok := r.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
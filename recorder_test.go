@@ -0,0 +1,69 @@
+package Trpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/LucienVen/Trpc/core"
+)
+
+// 并发安全的 bytes.Buffer
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
+
+func TestRecorder(t *testing.T) {
+	t.Parallel()
+
+	var buf syncBuffer
+	server := NewServer()
+	server.Recorder = NewRecorder(&buf, &RecordOption{Methods: []string{"Foo.Sum"}})
+	var foo Foo
+	_ = server.Register(&foo)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+
+	// 录制与编解码类型无关，JSON 客户端可以不依赖 Go 类型调用
+	client, _ := Dial("tcp", l.Addr().String(), &Option{CodecType: core.JosnType})
+	defer func() { _ = client.Close() }()
+
+	var reply json.RawMessage
+	ctx := WithPriority(context.Background(), PriorityInteractive)
+	err := client.Call(ctx, "Foo.Sum", json.RawMessage(`{"Num1":1,"Num2":2}`), &reply)
+	_assert(err == nil && string(reply) == "3", "json call failed: %v %s", err, reply)
+	err = client.Call(context.Background(), "Foo.Missing", Args{}, &reply)
+	_assert(err != nil, "expect an error for unknown method")
+
+	// 录制结果在回复之前写入，只录制 Foo.Sum
+	var records []RecordedCall
+	scanner := bufio.NewScanner(bytes.NewReader(buf.Bytes()))
+	for scanner.Scan() {
+		var rc RecordedCall
+		_assert(json.Unmarshal(scanner.Bytes(), &rc) == nil, "invalid record line %s", scanner.Text())
+		records = append(records, rc)
+	}
+	_assert(len(records) == 1, "expect 1 record, but got %d", len(records))
+	rc := records[0]
+	_assert(rc.ServiceMethod == "Foo.Sum" && rc.Code == "OK" && string(rc.Reply) == "3", "unexpected record %+v", rc)
+	_assert(string(rc.Args) == `{"Num1":1,"Num2":2}`, "unexpected args %s", rc.Args)
+	_assert(PriorityFromContext(rc.Context(context.Background())) == PriorityInteractive,
+		"priority should be recorded, meta %v", rc.Meta)
+}
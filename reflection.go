@@ -0,0 +1,157 @@
+/**
+ * @Author : liangliangtoo
+ * @File : reflection
+ * @Date: 2026/10/19 05:00
+ * @Description: 内置的 Reflection 服务，供命令行、网关等工具发现服务端注册的服务、方法与类型结构
+ */
+package Trpc
+
+import (
+	"reflect"
+	"sort"
+)
+
+/**
+使用方式：
+	_ = server.RegisterReflection()
+	var services []Trpc.ServiceInfo
+	_ = client.Call(ctx, "Reflection.List", Trpc.ListArgs{}, &services)
+命令行：
+	trpcurl tcp@127.0.0.1:9999 list
+	trpcurl tcp@127.0.0.1:9999 describe Foo.Sum
+参数与响应类型按结构描述（字段、种类、嵌套类型），工具无需共享 Go 源码即可构造请求
+*/
+
+// ListArgs Reflection.List 的参数
+type ListArgs struct {
+	Service string // 只返回该服务，默认为空代表全部
+}
+
+// ServiceInfo 服务的描述
+type ServiceInfo struct {
+	Name    string       `json:"name"`
+	Methods []MethodInfo `json:"methods"`
+}
+
+// MethodInfo 方法的描述，流方法没有参数与响应类型
+type MethodInfo struct {
+	Name       string    `json:"name"`
+	ArgType    string    `json:"argType,omitempty"`
+	ReplyType  string    `json:"replyType,omitempty"`
+	Args       *TypeInfo `json:"args,omitempty"`  // ArgType 的结构
+	Reply      *TypeInfo `json:"reply,omitempty"` // ReplyType 的结构
+	Stream     bool      `json:"stream"`
+	Idempotent bool      `json:"idempotent"`
+}
+
+// TypeInfo 类型的结构描述
+type TypeInfo struct {
+	Name   string      `json:"name,omitempty"`   // 具名类型的名称，如 "Trpc.Args"、"int"
+	Kind   string      `json:"kind"`             // reflect.Kind，如 "struct"、"ptr"、"slice"、"map"
+	Elem   *TypeInfo   `json:"elem,omitempty"`   // ptr、slice、array 的元素类型，map 的值类型
+	Key    *TypeInfo   `json:"key,omitempty"`    // map 的键类型
+	Len    int         `json:"len,omitempty"`    // array 的长度
+	Fields []FieldInfo `json:"fields,omitempty"` // struct 的导出字段
+	Ref    bool        `json:"ref,omitempty"`    // 递归引用外层的同名类型，结构见外层的描述
+}
+
+// FieldInfo 结构体字段的描述
+type FieldInfo struct {
+	Name     string    `json:"name"`
+	Type     *TypeInfo `json:"type"`
+	Tag      string    `json:"tag,omitempty"` // 完整的 struct tag，如 json:"id,omitempty"
+	Embedded bool      `json:"embedded,omitempty"`
+}
+
+// Reflection 返回服务端注册的服务，以及参数与响应类型的结构
+type Reflection struct {
+	server *Server
+}
+
+// List 返回注册的服务与方法，按名称排序
+func (r *Reflection) List(args ListArgs, reply *[]ServiceInfo) error {
+	var services []ServiceInfo
+	r.server.serviceMap.Range(func(namei, svci interface{}) bool {
+		name, svc := namei.(string), svci.(*service)
+		if args.Service != "" && args.Service != name {
+			return true
+		}
+		services = append(services, describeService(name, svc))
+		return true
+	})
+	if args.Service != "" && len(services) == 0 {
+		return Errorf(CodeNotFound, "rpc server: can't find service %s", args.Service)
+	}
+
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+	*reply = services
+	return nil
+}
+
+func describeService(name string, svc *service) ServiceInfo {
+	info := ServiceInfo{Name: name, Methods: make([]MethodInfo, 0, len(svc.method))}
+	for mname, mtype := range svc.method {
+		m := MethodInfo{Name: mname, Stream: mtype.stream, Idempotent: mtype.idempotent}
+		if !mtype.stream {
+			m.ArgType, m.ReplyType = mtype.ArgType.String(), mtype.ReplyType.String()
+			m.Args, m.Reply = describeType(mtype.ArgType, nil), describeType(mtype.ReplyType, nil)
+		}
+		info.Methods = append(info.Methods, m)
+	}
+	sort.Slice(info.Methods, func(i, j int) bool { return info.Methods[i].Name < info.Methods[j].Name })
+	return info
+}
+
+// 递归描述类型，path 为外层正在描述的具名类型，用于截断递归类型
+// 递归只能经过具名类型（如 type Tree map[string]Tree），任何 Kind 的具名类型都需要记录
+func describeType(t reflect.Type, path map[reflect.Type]bool) *TypeInfo {
+	info := &TypeInfo{Name: t.String(), Kind: t.Kind().String()}
+	if t.Name() == "" {
+		// 匿名类型（如 *int、[]string）的结构由 Kind 与 Elem 表示
+		info.Name = ""
+	} else {
+		if path[t] {
+			info.Ref = true
+			return info
+		}
+		if path == nil {
+			path = make(map[reflect.Type]bool)
+		}
+		path[t] = true
+		defer delete(path, t)
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice:
+		info.Elem = describeType(t.Elem(), path)
+	case reflect.Array:
+		info.Elem, info.Len = describeType(t.Elem(), path), t.Len()
+	case reflect.Map:
+		info.Key, info.Elem = describeType(t.Key(), path), describeType(t.Elem(), path)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			// 只有导出字段会被编码
+			if f.PkgPath != "" && !f.Anonymous {
+				continue
+			}
+			info.Fields = append(info.Fields, FieldInfo{
+				Name:     f.Name,
+				Type:     describeType(f.Type, path),
+				Tag:      string(f.Tag),
+				Embedded: f.Anonymous,
+			})
+		}
+	}
+	return info
+}
+
+// RegisterReflection 注册 Reflection 服务，默认不注册
+func (s *Server) RegisterReflection() error {
+	return s.Register(&Reflection{server: s}, &RegisterOption{Idempotent: []string{"List"}})
+}
+
+// 在 DefaultServer 中注册 Reflection 服务
+func RegisterReflection() error {
+	return DefaultServer.RegisterReflection()
+}
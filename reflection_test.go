@@ -0,0 +1,76 @@
+package Trpc
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestReflection(t *testing.T) {
+	t.Parallel()
+
+	server := NewServer()
+	var foo Foo
+	_ = server.Register(&foo)
+	_assert(server.RegisterReflection() == nil, "register reflection failed")
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+
+	client, _ := Dial("tcp", l.Addr().String())
+	defer func() { _ = client.Close() }()
+
+	var services []ServiceInfo
+	err := client.Call(context.Background(), "Reflection.List", ListArgs{}, &services)
+	_assert(err == nil && len(services) == 2, "list failed: %v %+v", err, services)
+	_assert(services[0].Name == "Foo" && services[1].Name == "Reflection", "services should be sorted: %+v", services)
+	sum := services[0].Methods[0]
+	_assert(sum.Name == "Sum" && sum.ArgType == "Trpc.Args" && sum.ReplyType == "*int", "unexpected method %+v", sum)
+	_assert(services[1].Methods[0].Idempotent, "Reflection.List should be idempotent")
+
+	// 参数与响应的结构
+	args := sum.Args
+	_assert(args.Name == "Trpc.Args" && args.Kind == "struct" && len(args.Fields) == 2, "unexpected args %+v", args)
+	_assert(args.Fields[0].Name == "Num1" && args.Fields[0].Type.Kind == "int", "unexpected field %+v", args.Fields[0])
+	_assert(sum.Reply.Kind == "ptr" && sum.Reply.Name == "" && sum.Reply.Elem.Kind == "int", "unexpected reply %+v", sum.Reply)
+
+	err = client.Call(context.Background(), "Reflection.List", ListArgs{Service: "Bar"}, &services)
+	_assert(ErrorCode(err) == CodeNotFound, "expect not found, but got %v", err)
+}
+
+type Tree struct {
+	Value    int               `json:"value"`
+	Children []*Tree           `json:"children"`
+	Labels   map[string][2]int `json:"labels"`
+	weight   int
+}
+
+// 不经过结构体的递归类型
+type Forest map[string]Forest
+
+type Chain []*Chain
+
+func TestDescribeType(t *testing.T) {
+	t.Parallel()
+
+	info := describeType(reflect.TypeOf(Tree{}), nil)
+	_assert(info.Kind == "struct" && len(info.Fields) == 3, "unexported fields should be skipped: %+v", info.Fields)
+	_assert(info.Fields[0].Tag == `json:"value"`, "unexpected tag %q", info.Fields[0].Tag)
+
+	// 递归类型引用外层的描述
+	child := info.Fields[1].Type
+	_assert(child.Kind == "slice" && child.Elem.Kind == "ptr", "unexpected children %+v", child)
+	_assert(child.Elem.Elem.Name == "Trpc.Tree" && child.Elem.Elem.Ref && child.Elem.Elem.Fields == nil,
+		"recursive type should be a reference: %+v", child.Elem.Elem)
+
+	labels := info.Fields[2].Type
+	_assert(labels.Kind == "map" && labels.Key.Kind == "string" && labels.Elem.Kind == "array" && labels.Elem.Len == 2,
+		"unexpected labels %+v", labels)
+
+	forest := describeType(reflect.TypeOf(Forest{}), nil)
+	_assert(forest.Kind == "map" && forest.Elem.Name == "Trpc.Forest" && forest.Elem.Ref,
+		"recursive map should be a reference: %+v", forest.Elem)
+	chain := describeType(reflect.TypeOf(Chain{}), nil)
+	_assert(chain.Elem.Kind == "ptr" && chain.Elem.Elem.Name == "Trpc.Chain" && chain.Elem.Elem.Ref,
+		"recursive slice should be a reference: %+v", chain.Elem.Elem)
+}
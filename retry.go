@@ -0,0 +1,132 @@
+/**
+ * @Author : liangliangtoo
+ * @File : retry
+ * @Date: 2026/10/18 18:10
+ * @Description: 客户端重试策略，只重试幂等的方法
+ */
+package Trpc
+
+import (
+	"context"
+	"time"
+)
+
+// 响应头元数据：方法在服务端注册时被声明为幂等
+const MetaIdempotent = "idempotent"
+
+// RetryPolicy 重试策略
+// 只有服务端声明为幂等（Register 时的 RegisterOption.Idempotent），
+// 或调用方在 Idempotent 中标记的方法才会重试
+// 配置在 Client 上时只重试连接仍然可用的请求，连接断开后的重试需要 ReconnectingClient
+type RetryPolicy struct {
+	MaxAttempts    int           // 最多尝试次数（包含第一次），默认3
+	InitialBackoff time.Duration // 第一次重试前的等待时间，默认50ms，之后每次翻倍
+	MaxBackoff     time.Duration // 等待时间上限，默认1s
+	RetryableCodes []Code        // 可重试的错误码，默认 CodeUnavailable
+	Idempotent     []string      // 调用方标记为幂等的方法，格式 Service.Method
+}
+
+// 按策略执行 attempt，idempotent 判断方法是否被服务端声明为幂等
+func (p *RetryPolicy) do(ctx context.Context, serviceMethod string, idempotent func(string) bool, attempt func() error) error {
+	maxAttempts := p.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 3
+	}
+	backoff := p.InitialBackoff
+	if backoff <= 0 {
+		backoff = time.Millisecond * 50
+	}
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = time.Second
+	}
+
+	var err error
+	for i := 1; ; i++ {
+		err = attempt()
+		if f, ok := err.(*finalError); ok {
+			return f.err
+		}
+		if err == nil || i >= maxAttempts || !p.retryable(err) {
+			return err
+		}
+		if !p.isIdempotent(serviceMethod) && !idempotent(serviceMethod) {
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// attempt 返回 finalError 时不再重试，返回其中的错误
+type finalError struct {
+	err error
+}
+
+func (e *finalError) Error() string {
+	return e.err.Error()
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	code := ErrorCode(err)
+	if len(p.RetryableCodes) == 0 {
+		return code == CodeUnavailable
+	}
+	for _, c := range p.RetryableCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *RetryPolicy) isIdempotent(serviceMethod string) bool {
+	for _, m := range p.Idempotent {
+		if m == serviceMethod {
+			return true
+		}
+	}
+	return false
+}
+
+// IsIdempotent 方法是否被服务端声明为幂等，或在重试策略中被标记为幂等
+func (client *Client) IsIdempotent(serviceMethod string) bool {
+	if client.opt.Retry != nil && client.opt.Retry.isIdempotent(serviceMethod) {
+		return true
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return client.idempotent[serviceMethod]
+}
+
+func (client *Client) markIdempotent(serviceMethod string) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.idempotent[serviceMethod] = true
+}
+
+// 重连后保留旧连接上学习到的幂等方法
+func (client *Client) inheritIdempotent(old *Client) {
+	old.mu.Lock()
+	methods := make([]string, 0, len(old.idempotent))
+	for m := range old.idempotent {
+		methods = append(methods, m)
+	}
+	old.mu.Unlock()
+
+	for _, m := range methods {
+		client.markIdempotent(m)
+	}
+}
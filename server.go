@@ -8,17 +8,19 @@
 package Trpc
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/LucienVen/Trpc/core"
 	"io"
-	"log"
 	"net"
 	"net/http"
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -30,6 +32,15 @@ type Option struct {
 	CodecType   core.Ttype
 	ConnectTimeout time.Duration	// 默认0，代表无限制
 	HandleTimeout time.Duration
+	StreamWindow int // 流控窗口（未被对端消费的消息数量），默认0代表 defaultStreamWindow
+	Credential string `json:",omitempty"` // 客户端凭证，由 Server.Authenticate 校验
+	Retry *RetryPolicy `json:"-"` // 客户端的重试策略，默认 nil 代表不重试
+	Tracer *Tracer `json:"-"` // 客户端的链路追踪，默认 nil 代表只透传 trace 上下文
+	Logger Logger `json:"-"` // 客户端的日志，默认 nil 代表不输出
+
+	KeepaliveInterval time.Duration // 客户端发送心跳的间隔，默认0代表不发送
+	KeepaliveTimeout  time.Duration // 等待心跳回复的时间，默认0代表与 KeepaliveInterval 相同
+	IdleTimeout       time.Duration // 服务端在该时间内未收到任何数据且没有进行中的请求时关闭连接，默认0代表不限制；与 Server.IdleTimeout 取较小值
 }
 
 var DefaultOption = &Option{
@@ -42,6 +53,27 @@ var DefaultOption = &Option{
 
 type Server struct {
 	serviceMap sync.Map
+	activeConns int64  // 当前的连接数
+	totalConns  uint64 // 累计接受的连接数
+	connMu      sync.Mutex
+	conns       map[uint64]*serverConn
+	nextConnID  uint64
+
+	Limiter     *Limiter     // 并发限制，默认 nil 代表不限制
+	RateLimiter *RateLimiter // 限流，默认 nil 代表不限制
+	Workers     *WorkerPool  // 执行请求的 worker 池，默认 nil 代表每个请求一个 goroutine
+	Tracer      *Tracer      // 链路追踪，默认 nil 代表只透传 trace 上下文
+	Logger      Logger       // 日志，默认 nil 代表不输出
+	AccessLog   AccessLogger // 访问日志，每个请求一行，默认 nil 代表不记录
+	Recorder    *Recorder    // 录制请求，默认 nil 代表不录制
+
+	// IdleTimeout 服务端的空闲超时，默认0代表只使用客户端 Option.IdleTimeout
+	// 两者都设置时取较小值，客户端不能关闭或延长服务端的空闲回收
+	IdleTimeout time.Duration
+
+	// Authenticate 校验客户端凭证并返回调用方主体，返回错误时关闭连接
+	// remoteAddr 为连接的远端地址，无法获取时为空；默认 nil 代表不校验
+	Authenticate func(remoteAddr, credential string) (principal string, err error)
 }
 
 func NewServer() *Server {
@@ -54,7 +86,7 @@ func (s *Server) Accept(lis net.Listener) {
 	for {
 		conn, err := lis.Accept()
 		if err != nil {
-			log.Println("rpc server: accept error:", err.Error())
+			s.logger().Log(LevelError, "rpc server: accept error", F("err", err))
 			return
 		}
 
@@ -71,69 +103,516 @@ func (s *Server) ServeConn(conn io.ReadWriteCloser) {
 		_ = conn.Close()
 	}()
 
+	counting := &countingConn{ReadWriteCloser: conn}
 	var opt Option
-	if err := json.NewDecoder(conn).Decode(&opt); err != nil {
-		log.Println("rpc server: options error: ", err)
+	dec := json.NewDecoder(counting)
+	if err := dec.Decode(&opt); err != nil {
+		s.logger().Log(LevelWarn, "rpc server: options error", F("err", err))
 		return
 	}
 
 	if opt.MagicNumber != DefaultMagicNumber {
-		log.Printf("rpc server: invalid magic number %x", opt.MagicNumber)
+		s.logger().Log(LevelWarn, "rpc server: invalid magic number", F("magic", fmt.Sprintf("%x", opt.MagicNumber)))
 		return
 	}
 
 	f := core.NewCodecFuncMap[opt.CodecType]
 	if f == nil {
-		log.Printf("rpc server: invalid codec type %s", opt.CodecType)
+		s.logger().Log(LevelWarn, "rpc server: invalid codec type", F("codec", opt.CodecType))
 		return
 	}
 
-	s.serveCodec(f(conn), &opt)
+	// 调用方身份：认证主体，默认为远端地址
+	var remoteAddr, identity, principal string
+	if nc, ok := conn.(net.Conn); ok && nc.RemoteAddr() != nil {
+		remoteAddr = nc.RemoteAddr().String()
+		identity = remoteAddr
+		if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+			identity = host
+		}
+	}
+	if s.Authenticate != nil {
+		var err error
+		principal, err = s.Authenticate(remoteAddr, opt.Credential)
+		if err != nil {
+			s.logger().Log(LevelWarn, "rpc server: authenticate error", F("remote", remoteAddr), F("err", err))
+			return
+		}
+		if principal != "" {
+			identity = principal
+		}
+	}
+
+	// json.Decoder 可能预读了 option 之后的请求数据，需要交还给编解码器
+	r := bufio.NewReader(io.MultiReader(dec.Buffered(), counting))
+	bc := &bufferedConn{r: r, WriteCloser: counting}
+	sc := &serverConn{conn: counting, reader: bc, remoteAddr: remoteAddr, identity: identity, principal: principal}
+	s.serveCodec(sc, f(bc), &opt)
+}
+
+// 先读取已缓冲的数据，再读取原连接
+// 实现 io.ByteReader，gob.Decoder 不会再预读，consumed 即为编解码器实际读取的字节数
+type bufferedConn struct {
+	r        *bufio.Reader
+	started  bool
+	consumed uint64 // 只在读循环中访问
+	io.WriteCloser
+}
+
+func (c *bufferedConn) start() {
+	if !c.started {
+		// json.Encoder 会在 option 之后写入一个换行符，需要跳过
+		c.started = true
+		if b, err := c.r.Peek(1); err == nil && b[0] == '\n' {
+			_, _ = c.r.Discard(1)
+		}
+	}
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	c.start()
+	n, err := c.r.Read(p)
+	c.consumed += uint64(n)
+	return n, err
+}
+
+func (c *bufferedConn) ReadByte() (byte, error) {
+	c.start()
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.consumed++
+	}
+	return b, err
 }
 
 // 发生错误时候的占位符
 var invalidRequest = struct{}{}
 
-func (s *Server) serveCodec(cc core.Codec, opt *Option) {
-	sending := new(sync.Mutex)
-	wg := new(sync.WaitGroup)
+// 服务端的单个连接
+type serverConn struct {
+	cc      core.Codec
+	opt     *Option
+	id         uint64
+	conn       *countingConn // 底层连接，统计读写字节数
+	reader     *bufferedConn // 编解码器读取的连接，统计每个请求的字节数
+	remoteAddr string
+	identity   string // 调用方身份，用于限流
+	principal  string // Server.Authenticate 返回的主体
+	logger     Logger
+	connectedAt time.Time
+	requests    uint64 // 收到的请求数
+	sending *sync.Mutex // 互斥锁，保证响应完整写出
+	wg      *sync.WaitGroup
+	active   int32 // 正在处理的请求和流
+	lastRead int64 // 最近一次收到数据的时间（UnixNano）
+	ctx     context.Context // 连接的上下文，保存回调句柄，连接断开时取消
+	cancel  context.CancelFunc
+
+	mu        sync.Mutex
+	streams   map[uint64]*ServerStream // 活跃的流，map[seq]*ServerStream
+	callbacks map[uint64]*Call         // 等待客户端回复的回调，map[seq]*Call
+	cbSeq     uint64                   // 回调序号，与客户端的请求序号相互独立
+	closed    bool
+}
+
+// 在发送锁下写出一帧（流消息使用）
+func (sc *serverConn) writeFrame(h *core.Header, body interface{}) error {
+	sc.sending.Lock()
+	defer sc.sending.Unlock()
+
+	return sc.cc.Write(h, body)
+}
+
+// 在新的 goroutine 中处理请求，连接关闭前等待其结束
+func (sc *serverConn) spawn(f func()) {
+	sc.wg.Add(1)
+	atomic.AddInt32(&sc.active, 1)
+	go func() {
+		defer sc.wg.Done()
+		defer atomic.AddInt32(&sc.active, -1)
+		f()
+	}()
+}
+
+// 在 worker 池中处理请求，连接关闭前同样等待其结束
+func (sc *serverConn) submit(pool *WorkerPool, priority Priority, f func()) error {
+	sc.wg.Add(1)
+	atomic.AddInt32(&sc.active, 1)
+	err := pool.submit(sc, priority, func() {
+		defer sc.wg.Done()
+		defer atomic.AddInt32(&sc.active, -1)
+		f()
+	})
+	if err != nil {
+		atomic.AddInt32(&sc.active, -1)
+		sc.wg.Done()
+	}
+	return err
+}
+
+// 服务端与客户端的空闲超时取较小值，0代表该方不限制
+func idleTimeout(server, client time.Duration) time.Duration {
+	if server <= 0 || (client > 0 && client < server) {
+		return client
+	}
+	return server
+}
+
+// 空闲超时后关闭连接，读循环随之退出
+func (sc *serverConn) watchIdle(timeout time.Duration) *time.Timer {
+	atomic.StoreInt64(&sc.lastRead, time.Now().UnixNano())
+
+	var timer *time.Timer
+	timer = time.AfterFunc(timeout, func() {
+		idle := time.Since(time.Unix(0, atomic.LoadInt64(&sc.lastRead)))
+		if idle < timeout || atomic.LoadInt32(&sc.active) > 0 {
+			// 期间收到过数据或仍有请求在处理，继续等待
+			timer.Reset(timeout - idle%timeout)
+			return
+		}
+
+		sc.logger.Log(LevelInfo, "rpc server: close idle connection", F("remote", sc.remoteAddr), F("idle", idle))
+		_ = sc.cc.Close()
+	})
+	return timer
+}
+
+func (sc *serverConn) getStream(seq uint64) *ServerStream {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.streams[seq]
+}
+
+func (sc *serverConn) removeStream(seq uint64) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	delete(sc.streams, seq)
+}
+
+func (s *Server) serveCodec(sc *serverConn, cc core.Codec, opt *Option) {
+	sc.cc = cc
+	sc.opt = opt
+	sc.connectedAt = time.Now()
+	sc.logger = s.logger()
+	sc.sending = new(sync.Mutex)
+	sc.wg = new(sync.WaitGroup)
+	sc.streams = make(map[uint64]*ServerStream)
+	sc.callbacks = make(map[uint64]*Call)
+	sc.cbSeq = 1
+	sc.ctx, sc.cancel = context.WithCancel(context.WithValue(context.Background(), callbackKey{}, &Callback{sc: sc}))
+	atomic.AddUint64(&s.totalConns, 1)
+	atomic.AddInt64(&s.activeConns, 1)
+	defer atomic.AddInt64(&s.activeConns, -1)
+	s.addConn(sc)
+	defer s.removeConn(sc)
+
+	if timeout := idleTimeout(s.IdleTimeout, opt.IdleTimeout); timeout > 0 {
+		idle := sc.watchIdle(timeout)
+		defer idle.Stop()
+	}
 
 	for {
-		req, err := s.readRequest(cc)
+		consumed := sc.consumed()
+		h, err := s.readRequestHeader(sc)
 		if err != nil {
-			if err != nil {
-				if req == nil {
-					break
-				}
-				req.h.Error = err.Error()
-				s.sendResponse(cc, req.h, invalidRequest, sending)
-				continue
+			break
+		}
+		atomic.StoreInt64(&sc.lastRead, time.Now().UnixNano())
+		switch h.Kind {
+		case core.KindCall, core.KindNotify, core.KindBatch, core.KindStreamOpen:
+			atomic.AddUint64(&sc.requests, 1)
+		}
+
+		if h.Kind == core.KindPing {
+			if err = cc.ReadBody(nil); err != nil {
+				break
+			}
+			s.sendResponse(cc, &core.Header{Seq: h.Seq, Kind: core.KindPong}, invalidRequest, sc.sending)
+			continue
+		}
+
+		if h.Kind.IsStream() {
+			if err = s.serveStream(sc, h); err != nil {
+				break
+			}
+			continue
+		}
+
+		if h.Kind == core.KindCallbackReply {
+			if err = sc.receiveCallbackReply(h); err != nil {
+				break
+			}
+			continue
+		}
+
+		if h.Kind == core.KindBatch {
+			if err = s.serveBatch(sc, h, consumed); err != nil {
+				break
+			}
+			continue
+		}
+
+		req, err := s.readRequest(cc, h)
+		if req != nil {
+			req.start = time.Now()
+			req.size = sc.consumed() - consumed
+			req.meta = h.Meta
+		}
+		if err != nil {
+			if req == nil {
+				break
+			}
+			var size uint64
+			if req.h.Kind != core.KindNotify {
+				// 响应只携带服务端的元数据
+				req.h.Meta = nil
+				setHeaderError(req.h, err)
+				size = s.respond(sc, req.h, invalidRequest)
 			}
+			s.access(sc, req.h, req.start, req.size, size, err)
+			continue
 		}
 
-		wg.Add(1)
-		go s.handleRequest(cc, req, sending, wg, opt.HandleTimeout)
+		req.ctx = sc.ctx
+		s.dispatch(sc, req)
 	}
 
-	wg.Wait()
+	// 连接断开，中止所有的流和回调
+	sc.mu.Lock()
+	sc.closed = true
+	for _, ss := range sc.streams {
+		ss.abort(ErrShutdown)
+	}
+	for seq, call := range sc.callbacks {
+		delete(sc.callbacks, seq)
+		call.Error = ErrShutdown
+		call.done()
+	}
+	sc.mu.Unlock()
+	sc.cancel()
+
+	sc.wg.Wait()
 	_ = cc.Close()
 }
 
+// 按限流与并发限制执行请求，超出限制时直接回复错误
+func (s *Server) dispatch(sc *serverConn, req *request) {
+	reject := func(err error) {
+		req.mtype.metrics.reject(err)
+		if req.slot != nil {
+			req.slot.done(req, err)
+			return
+		}
+		var size uint64
+		if req.h.Kind != core.KindNotify {
+			req.h.Meta = nil
+			setHeaderError(req.h, err)
+			size = s.respond(sc, req.h, invalidRequest)
+		}
+		s.access(sc, req.h, req.start, req.size, size, err)
+	}
+
+	// 处理函数的上下文携带请求的优先级与上游的 trace 上下文
+	priority := headerPriority(req.h)
+	if priority != PriorityNormal {
+		req.ctx = WithPriority(req.ctx, priority)
+	}
+	if span, ok := headerSpan(req.h); ok {
+		req.ctx = ContextWithSpan(req.ctx, span)
+	}
+	req.peer = sc.remoteAddr
+
+	if s.RateLimiter != nil {
+		if wait, ok := s.RateLimiter.allow(sc.identity, req.h.ServiceMethod); !ok {
+			reject(rateLimitError(req.h.ServiceMethod, wait))
+			return
+		}
+	}
+
+	var t *ticket
+	if s.Limiter != nil {
+		var err error
+		if t, err = s.Limiter.reserve(req.h.ServiceMethod, priority); err != nil {
+			reject(err)
+			return
+		}
+		req.release = t.release
+	}
+
+	if s.Workers == nil {
+		sc.spawn(func() {
+			if t != nil {
+				// 排队期间连接断开则放弃处理
+				if err := t.wait(req.ctx); err != nil {
+					req.abandon(err)
+					return
+				}
+			}
+			s.handleRequest(sc, req, sc.opt.HandleTimeout)
+		})
+		return
+	}
+
+	// worker 只执行已经获得名额的请求：排队中的请求若先占用 worker，
+	// 持有名额的请求可能一直等不到 worker
+	submit := func() {
+		err := sc.submit(s.Workers, priority, func() {
+			s.handleRequest(sc, req, sc.opt.HandleTimeout)
+		})
+		if err != nil {
+			if t != nil {
+				t.release()
+			}
+			reject(err)
+		}
+	}
+	if t == nil || t.acquired() {
+		submit()
+		return
+	}
+	sc.spawn(func() {
+		if err := t.wait(req.ctx); err != nil {
+			req.abandon(err)
+			return
+		}
+		submit()
+	})
+}
+
+// 处理流相关的帧
+func (s *Server) serveStream(sc *serverConn, h *core.Header) error {
+	cc := sc.cc
+	switch h.Kind {
+	case core.KindStreamOpen:
+		if err := cc.ReadBody(nil); err != nil {
+			return err
+		}
+
+		svc, mtype, err := s.findService(h.ServiceMethod)
+		if err == nil && !mtype.stream {
+			err = Errorf(CodeInvalidArgument, "rpc server: method is not a stream: %s", h.ServiceMethod)
+		}
+		if err == nil && s.RateLimiter != nil {
+			if wait, ok := s.RateLimiter.allow(sc.identity, h.ServiceMethod); !ok {
+				err = rateLimitError(h.ServiceMethod, wait)
+				mtype.metrics.reject(err)
+			}
+		}
+		// 流在整个生命周期内占用一个并发名额
+		var t *ticket
+		if err == nil && s.Limiter != nil {
+			if t, err = s.Limiter.reserve(h.ServiceMethod, headerPriority(h)); err != nil {
+				mtype.metrics.reject(err)
+			}
+		}
+		if err != nil {
+			h.Kind = core.KindStreamClose
+			h.Meta = nil
+			setHeaderError(h, err)
+			s.sendResponse(cc, h, invalidRequest, sc.sending)
+			return nil
+		}
+
+		ss := &ServerStream{newStream(sc.ctx, h.Seq, h.ServiceMethod, sc.opt.CodecType, sc.opt.StreamWindow, sc.writeFrame)}
+		sc.mu.Lock()
+		sc.streams[h.Seq] = ss
+		sc.mu.Unlock()
+
+		sc.spawn(func() {
+			if t != nil {
+				// 排队期间连接断开，流随连接一起中止
+				if err := t.wait(sc.ctx); err != nil {
+					sc.removeStream(ss.id)
+					ss.abort(ErrStreamClosed)
+					return
+				}
+				defer t.release()
+			}
+			s.handleStream(sc, svc, mtype, ss)
+		})
+		return nil
+	case core.KindStreamData:
+		var data []byte
+		if err := cc.ReadBody(&data); err != nil {
+			return err
+		}
+		if ss := sc.getStream(h.Seq); ss != nil && !ss.deliver(data) {
+			sc.removeStream(h.Seq)
+			ss.overflow()
+		}
+		return nil
+	case core.KindStreamWindow:
+		var n uint32
+		if err := cc.ReadBody(&n); err != nil {
+			return err
+		}
+		if ss := sc.getStream(h.Seq); ss != nil {
+			ss.addCredit(n)
+		}
+		return nil
+	case core.KindStreamClose:
+		// 客户端半关闭
+		if ss := sc.getStream(h.Seq); ss != nil {
+			ss.closeRecv(io.EOF)
+		}
+		return cc.ReadBody(nil)
+	case core.KindStreamReset:
+		if ss := sc.getStream(h.Seq); ss != nil {
+			sc.removeStream(h.Seq)
+			ss.abort(errStreamReset)
+		}
+		return cc.ReadBody(nil)
+	default:
+		return cc.ReadBody(nil)
+	}
+}
+
+// 运行流的处理函数，返回后向客户端发送最终错误
+func (s *Server) handleStream(sc *serverConn, svc *service, mtype *methodType, ss *ServerStream) {
+	err := svc.callStream(mtype, ss)
+	sc.removeStream(ss.id)
+
+	// 流被中止时 closeSend 返回 ErrStreamClosed，无需再通知客户端
+	_ = ss.closeSend(err)
+	ss.abort(ErrStreamClosed)
+}
+
 /** request 请求 **/
 type request struct {
-	h      *core.Header
-	argv   reflect.Value
-	replyv reflect.Value
-	mtype  *methodType
-	svc    *service
+	h       *core.Header
+	argv    reflect.Value
+	replyv  reflect.Value
+	mtype   *methodType
+	svc     *service
+	ctx     context.Context   // 连接的上下文
+	peer    string            // 客户端地址
+	start   time.Time         // 读取完成的时间
+	size    uint64            // 请求的字节数
+	meta    map[string]string // 请求头的元数据，回复时 h.Meta 会被替换
+	release func()            // 处理函数返回时归还并发名额，未启用 Limiter 时为 nil
+	slot    *batchSlot        // 批量调用中的请求，回复写入批量响应；其他请求为 nil
+}
+
+// 处理函数返回后调用
+func (req *request) finish() {
+	if req.release != nil {
+		req.release()
+	}
+}
+
+// 连接断开、请求未执行时调用：批量调用仍在等待每个请求结束
+func (req *request) abandon(err error) {
+	if req.slot != nil {
+		req.slot.done(req, err)
+	}
 }
 
 // 读取请求头
-func (s *Server) readRequestHeader(cc core.Codec) (*core.Header, error) {
+func (s *Server) readRequestHeader(sc *serverConn) (*core.Header, error) {
 	var h core.Header
-	if err := cc.ReadHeader(&h); err != nil {
+	if err := sc.cc.ReadHeader(&h); err != nil {
 		if err != io.EOF && err != io.ErrUnexpectedEOF {
-			log.Println("rpc server: read header err: ", err)
+			sc.logger.Log(LevelWarn, "rpc server: read header error", F("remote", sc.remoteAddr), F("err", err))
 		}
 		return nil, err
 	}
@@ -144,32 +623,28 @@ func (s *Server) readRequestHeader(cc core.Codec) (*core.Header, error) {
 //即通过 newArgv() 和 newReplyv() 两个方法创建出两个入参实例，
 //然后通过 cc.ReadBody() 将请求报文反序列化为第一个入参 argv，
 //在这里同样需要注意 argv 可能是值类型，也可能是指针类型，所以处理方式有点差异
-func (s *Server) readRequest(cc core.Codec) (*request, error) {
-	h, err := s.readRequestHeader(cc)
-	fmt.Println("log: h", h.ServiceMethod)
-	if err != nil {
-		return nil, err
-	}
-
+func (s *Server) readRequest(cc core.Codec, h *core.Header) (*request, error) {
 	req := &request{h: h}
 
+	var err error
 	req.svc, req.mtype, err = s.findService(h.ServiceMethod)
+	if err == nil && req.mtype.stream {
+		err = Errorf(CodeInvalidArgument, "rpc server: method is a stream: %s", h.ServiceMethod)
+	}
 	if err != nil {
-		return nil, err
+		// 丢弃请求体，继续处理后续请求
+		if rerr := cc.ReadBody(nil); rerr != nil {
+			return nil, rerr
+		}
+		return req, err
 	}
 
 	req.argv = req.mtype.newArgv()
 	req.replyv = req.mtype.newReplyv()
 
-	// 确保 argvi 是一个指针，ReadBody 需要一个指针作为参数
-	argvi := req.argv.Interface()
-	if req.argv.Type().Kind() != reflect.Ptr {
-		argvi = req.argv.Addr().Interface()
-	}
-
-	if err = cc.ReadBody(argvi); err != nil {
-		log.Println("rpc server: read body err:", err)
-		return req, err
+	if err = cc.ReadBody(argvInterface(req.argv)); err != nil {
+		s.logger().Log(LevelWarn, "rpc server: read body error", F("method", h.ServiceMethod), F("err", err))
+		return req, Errorf(CodeInvalidArgument, "rpc server: read body err: %v", err)
 	}
 
 
@@ -182,44 +657,94 @@ func (s *Server) readRequest(cc core.Codec) (*request, error) {
 	return req, nil
 }
 
+// 确保 argvi 是一个指针，ReadBody 需要一个指针作为参数
+func argvInterface(argv reflect.Value) interface{} {
+	if argv.Type().Kind() != reflect.Ptr {
+		return argv.Addr().Interface()
+	}
+	return argv.Interface()
+}
+
 // 处理请求
-func (s *Server) handleRequest(cc core.Codec, req *request, sending *sync.Mutex, wg *sync.WaitGroup, timeout time.Duration) {
-	defer wg.Done()
+func (s *Server) handleRequest(sc *serverConn, req *request, timeout time.Duration) {
+	// 单向调用：只执行处理函数，不回复
+	if req.h.Kind == core.KindNotify {
+		err := s.callRequest(req)
+		req.finish()
+		if err != nil {
+			s.logger().Log(LevelWarn, "rpc server: notify error", F("method", req.h.ServiceMethod), F("err", err))
+		}
+		s.access(sc, req.h, req.start, req.size, 0, err)
+		return
+	}
 	//log.Println(req.h, req.argv.Elem())
 	//req.replyv = reflect.ValueOf(fmt.Sprintf("Trpc resp: %v", req.h.Seq))
 
-	called := make(chan struct{})
-	sent := make(chan struct{})
+	// 处理函数在当前 goroutine（worker 或连接为请求创建的 goroutine）中执行，返回前一直占用它，
+	// 超时由 timer 提前回复；处理函数与超时只有一方回复，replied 由先到的一方置1
+	var replied int32
+	reply := func(err error) {
+		if !atomic.CompareAndSwapInt32(&replied, 0, 1) {
+			return
+		}
+		if req.slot != nil {
+			req.slot.done(req, err)
+			return
+		}
 
-	go func() {
-		err := req.svc.call(req.mtype, req.argv, req.replyv)
-		called <- struct{}{}
+		var body interface{} = invalidRequest
 		if err != nil {
-			req.h.Error = err.Error()
-			s.sendResponse(cc, req.h, invalidRequest, sending)
-			sent <- struct{}{}
-			return
+			setHeaderError(req.h, err)
+		} else {
+			body = req.replyv.Interface()
 		}
+		s.access(sc, req.h, req.start, req.size, s.respond(sc, req.h, body), err)
+	}
 
-		s.sendResponse(cc, req.h, req.replyv.Interface(), sending)
-		sent <- struct{}{}
-	}()
+	// 响应只携带服务端的元数据
+	req.h.Meta = nil
+	if req.mtype.idempotent {
+		req.h.Meta = map[string]string{MetaIdempotent: "true"}
+	}
 
-	if timeout == 0 {
-		<-called
-		<-sent
-		return
+	// timeout 为0时只等待处理函数
+	if timeout > 0 {
+		t := time.AfterFunc(timeout, func() {
+			reply(Errorf(CodeDeadlineExceeded, "rpc server: request handle timeout: expect within %s", timeout))
+		})
+		defer t.Stop()
 	}
 
-	select {
-	case <-time.After(timeout):
-		req.h.Error = fmt.Sprintf("rpc server: request handle timeout: expect within %s", timeout)
-		s.sendResponse(cc, req.h, invalidRequest, sending)
-	case <-called:
-		<-sent
+	err := s.callRequest(req)
+	req.finish()
+	reply(err)
+}
+
+// 在发送锁下写出响应，返回写出的字节数
+func (s *Server) respond(sc *serverConn, h *core.Header, body interface{}) uint64 {
+	sc.sending.Lock()
+	defer sc.sending.Unlock()
 
+	before := sc.bytesOut()
+	if err := sc.cc.Write(h, body); err != nil {
+		s.logger().Log(LevelWarn, "rpc server: write response error", F("method", h.ServiceMethod), F("err", err))
 	}
-	//s.sendResponse(cc, req.h, req.replyv.Interface(), sending)
+	return sc.bytesOut() - before
+}
+
+// 在服务端 span 内执行处理函数
+func (s *Server) callRequest(req *request) error {
+	ctx, span := s.Tracer.start(req.ctx, req.h.ServiceMethod, "server", req.peer)
+	rc, rerr := s.Recorder.begin(req)
+	err := req.svc.callContext(ctx, req.mtype, req.argv, req.replyv)
+	span.end(err)
+	if rerr == nil {
+		rerr = s.Recorder.end(rc, req.replyv, err)
+	}
+	if rerr != nil {
+		s.logger().Log(LevelWarn, "rpc server: record request error", F("method", req.h.ServiceMethod), F("err", rerr))
+	}
+	return err
 }
 
 // 回复请求
@@ -228,45 +753,67 @@ func (s *Server) sendResponse(cc core.Codec, h *core.Header, body interface{}, s
 	defer sending.Unlock()
 
 	if err := cc.Write(h, body); err != nil {
-		log.Println("rpc server: write response error:", err)
+		s.logger().Log(LevelWarn, "rpc server: write response error", F("method", h.ServiceMethod), F("err", err))
 	}
 }
 
 // 服务注册（注册在服务器上发布的方案集）
-func (s *Server) Register(rcvr interface{}) error {
+// RegisterOption 注册服务时的可选参数
+type RegisterOption struct {
+	Idempotent []string // 幂等的方法名，响应中会告知客户端，允许其重试
+}
+
+func (s *Server) Register(rcvr interface{}, opts ...*RegisterOption) error {
+	if err := checkServiceName(rcvr); err != nil {
+		return err
+	}
 	newServer := newService(rcvr)
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		for _, name := range opt.Idempotent {
+			mtype := newServer.method[name]
+			if mtype == nil {
+				return errors.New("rpc: idempotent method not found: " + newServer.name + "." + name)
+			}
+			mtype.idempotent = true
+		}
+	}
+
 	if _, dup := s.serviceMap.LoadOrStore(newServer.name, newServer); dup {
 		return errors.New("rpc: service already defined: " + newServer.name)
 	}
+	for name := range newServer.method {
+		s.logger().Log(LevelDebug, "rpc server: register", F("method", newServer.name+"."+name))
+	}
 
 	return nil
 }
 
 // 注册在 DefaultServer 中发布接收者的方法
-func Register(rcvr interface{}) error {
-	return DefaultServer.Register(rcvr)
+func Register(rcvr interface{}, opts ...*RegisterOption) error {
+	return DefaultServer.Register(rcvr, opts...)
 }
 
 // 寻找服务（通过ServiceMethod 从 serviceMap 中找到对应的service）
 func (s *Server) findService(serviceMethod string) (svc *service, mtype *methodType, err error) {
 	dot := strings.LastIndex(serviceMethod, ".")
 	if dot < 0 {
-		err = errors.New("rpc server: service/method request ill-formed: " + serviceMethod)
+		err = Errorf(CodeNotFound, "rpc server: service/method request ill-formed: %s", serviceMethod)
 		return
 	}
 
 	serviceName, methodName := serviceMethod[:dot], serviceMethod[dot+1:]
 	svci, ok := s.serviceMap.Load(serviceName)
 	if !ok {
-		err = errors.New("rpc server: can't find service " + serviceName)
+		err = Errorf(CodeNotFound, "rpc server: can't find service %s", serviceName)
 		return
 	}
-	fmt.Println("*************** first **************")
 	svc = svci.(*service)
-	fmt.Println("*************** after **************")
 	mtype = svc.method[methodName]
 	if mtype == nil {
-		err = errors.New("rpc server: can't find method " + methodName)
+		err = Errorf(CodeNotFound, "rpc server: can't find method %s", methodName)
 	}
 	return
 }
@@ -291,7 +838,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request)  {
 
 	conn, _, err := w.(http.Hijacker).Hijack()
 	if err != nil {
-		log.Print("rpc hijacking ", req.RemoteAddr, ": ", err.Error())
+		s.logger().Log(LevelError, "rpc server: hijacking error", F("remote", req.RemoteAddr), F("err", err))
 		return
 	}
 
@@ -303,7 +850,7 @@ func (s *Server) HandleHTTP()  {
 	http.Handle(defaultRPCPath, s)
 	// debugHTTP 实例绑定到地址
 	http.Handle(defaultDebugPath, debugHTTP{s})
-	log.Println("rpc server debug path:", defaultDebugPath)
+	s.logger().Log(LevelInfo, "rpc server: debug path", F("path", defaultDebugPath))
 }
 
 func HandleHTTP()  {
@@ -7,10 +7,12 @@
 package Trpc
 
 import (
+	"context"
+	"errors"
 	"go/ast"
-	"log"
 	"reflect"
 	"sync/atomic"
+	"time"
 )
 
 
@@ -22,12 +24,21 @@ type methodType struct {
 	ArgType   reflect.Type // 第一个参数类型
 	ReplyType reflect.Type // 第二个参数的类型
 	numCalls  uint64       // 统计方法调用次数
+	stream    bool         // 流方法，ArgType 与 ReplyType 为空
+	withCtx   bool         // 第一个参数为 context.Context
+	idempotent bool        // 注册时声明为幂等，允许客户端重试
+	metrics   callMetrics  // 请求数、错误码、延迟与正在处理的请求
 }
 
 func (m *methodType) NumCalls() uint64 {
 	return atomic.LoadUint64(&m.numCalls)
 }
 
+// IsStream 是否为流方法
+func (m *methodType) IsStream() bool {
+	return m.stream
+}
+
 // 创建ArgType类型实例
 func (m *methodType) newArgv() reflect.Value {
 	var argv reflect.Value
@@ -61,6 +72,15 @@ type service struct {
 	method map[string]*methodType	// 存储映射的结构体的所有符合条件的方法
 }
 
+// 服务名（结构体名称）必须是导出的
+func checkServiceName(rcvr interface{}) error {
+	name := reflect.Indirect(reflect.ValueOf(rcvr)).Type().Name()
+	if !ast.IsExported(name) {
+		return errors.New("rpc: " + name + " is not a valid service name")
+	}
+	return nil
+}
+
 // 构造函数，入参为任意需要映射为服务的结构体实例
 func newService(rcvr interface{}) *service {
 	s := new(service)
@@ -70,10 +90,7 @@ func newService(rcvr interface{}) *service {
 	//fmt.Println("s.name,indirect:", reflect.Indirect(s.rcvr).Type().Name())
 
 	s.typ = reflect.TypeOf(rcvr)
-	// 判断名称是否以大写字母开头（命名规则）
-	if !ast.IsExported(s.name) {
-		log.Fatalf("rpc server: %s is not a valid service name", s.name)
-	}
+	// 名称是否以大写字母开头（命名规则）由调用方先通过 checkServiceName 校验
 	s.registerMethods()
 
 	return s
@@ -88,21 +105,35 @@ func (s *service) registerMethods()  {
 		method := s.typ.Method(i) // 获取其中一个单一的方法
 		mType := method.Type // 获取该方法的类型，如 func(*sync.WaitGroup, int)
 
+		// 流方法：func (t *T) Method(stream *ServerStream) error
+		if mType.NumIn() == 2 && mType.NumOut() == 1 &&
+			mType.In(1) == typeOfServerStream && mType.Out(0) == typeOfError {
+			s.method[method.Name] = &methodType{
+				method: method,
+				stream: true,
+			}
+
+			continue
+		}
+
+		// 带上下文的方法：func (t *T) Method(ctx context.Context, args T1, reply *T2) error
+		withCtx := mType.NumIn() == 4 && mType.In(1) == typeOfContext
+
 		// 判断方法的入参和出参 数目
 		// 按照rpc调用定义，需要3个入参，和1个出参（反射时为三个，第0个是自身）
 		// 返回值有且只有一个，类型为error
-		if mType.NumIn() != 3 || mType.NumOut() != 1 {
+		if (mType.NumIn() != 3 && !withCtx) || mType.NumOut() != 1 {
 			continue
 		}
 
 		// 判断出参第一个参数类型
 		//fmt.Println("mType.Out(0):", mType.Out(0) )
-		if mType.Out(0) != reflect.TypeOf((*error)(nil)).Elem() {
+		if mType.Out(0) != typeOfError {
 			continue
 		}
 
 		// 判断调用的第一和第二个参数的类型
-		argType, replyType := mType.In(1), mType.In(2)
+		argType, replyType := mType.In(mType.NumIn()-2), mType.In(mType.NumIn()-1)
 		if !isExportedOrBuildInType(argType) || !isExportedOrBuildInType(replyType) {
 			continue
 		}
@@ -111,12 +142,17 @@ func (s *service) registerMethods()  {
 			method:    method,
 			ArgType:   argType,
 			ReplyType: replyType,
+			withCtx:   withCtx,
 		}
-
-		log.Printf("rpc server: register %s.%s\n", s.name, method.Name)
 	}
 }
 
+var (
+	typeOfError        = reflect.TypeOf((*error)(nil)).Elem()
+	typeOfServerStream = reflect.TypeOf((*ServerStream)(nil))
+	typeOfContext      = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
+
 func isExportedOrBuildInType(t reflect.Type) bool {
 	// PkgPath 返回定义类型的包路径，即导入路径
 	// ast.IsExported 判断是否可导出类型
@@ -126,10 +162,24 @@ func isExportedOrBuildInType(t reflect.Type) bool {
 
 // 实现call方法，即能够通过反射值调用方法
 func (s *service) call(m *methodType, argv, replyv reflect.Value) error {
+	return s.callContext(context.Background(), m, argv, replyv)
+}
+
+// 带上下文调用，上下文中保存了连接相关的信息（如回调）
+func (s *service) callContext(ctx context.Context, m *methodType, argv, replyv reflect.Value) (err error) {
 	atomic.AddUint64(&m.numCalls, 1)
+	m.metrics.begin()
+	defer func(start time.Time) {
+		m.metrics.end(err, time.Since(start))
+	}(time.Now())
+
 	// 以接收者为第一个参数的函数
 	f := m.method.Func
-	returnValues := f.Call([]reflect.Value{s.rcvr, argv, replyv})
+	in := []reflect.Value{s.rcvr, argv, replyv}
+	if m.withCtx {
+		in = []reflect.Value{s.rcvr, reflect.ValueOf(ctx), argv, replyv}
+	}
+	returnValues := f.Call(in)
 	if errInter := returnValues[0].Interface(); errInter != nil {
 		// TODO 这是什么意思
 		return errInter.(error)
@@ -138,6 +188,23 @@ func (s *service) call(m *methodType, argv, replyv reflect.Value) error {
 	return nil
 }
 
+// 调用流方法
+func (s *service) callStream(m *methodType, ss *ServerStream) (err error) {
+	atomic.AddUint64(&m.numCalls, 1)
+	m.metrics.begin()
+	defer func(start time.Time) {
+		m.metrics.end(err, time.Since(start))
+	}(time.Now())
+
+	f := m.method.Func
+	returnValues := f.Call([]reflect.Value{s.rcvr, reflect.ValueOf(ss)})
+	if errInter := returnValues[0].Interface(); errInter != nil {
+		return errInter.(error)
+	}
+
+	return nil
+}
+
 
 
 
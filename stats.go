@@ -0,0 +1,106 @@
+/**
+ * @Author : liangliangtoo
+ * @File : stats
+ * @Date: 2026/10/18 23:15
+ * @Description: 滑动窗口内的延迟统计，展示在调试页面
+ */
+package Trpc
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	statsWindow     = time.Minute // 延迟统计的滑动窗口
+	statsMaxSamples = 1024        // 窗口内最多保留的样本数，超出时覆盖最早的样本
+)
+
+type latencySample struct {
+	at time.Time
+	d  time.Duration
+}
+
+// 最近的延迟样本
+type recentLatency struct {
+	samples []latencySample
+	next    int
+}
+
+func (w *recentLatency) add(now time.Time, d time.Duration) {
+	if len(w.samples) < statsMaxSamples {
+		w.samples = append(w.samples, latencySample{at: now, d: d})
+		return
+	}
+	w.samples[w.next] = latencySample{at: now, d: d}
+	w.next = (w.next + 1) % len(w.samples)
+}
+
+// LatencyStats 滑动窗口内的延迟统计
+// JSON 中的时间单位为纳秒
+type LatencyStats struct {
+	Count int           `json:"count"`
+	Avg   time.Duration `json:"avg"`
+	P50   time.Duration `json:"p50"`
+	P95   time.Duration `json:"p95"`
+	P99   time.Duration `json:"p99"`
+}
+
+func (w *recentLatency) stats(now time.Time) LatencyStats {
+	var ds []time.Duration
+	var sum time.Duration
+	for _, s := range w.samples {
+		if now.Sub(s.at) <= statsWindow {
+			ds = append(ds, s.d)
+			sum += s.d
+		}
+	}
+
+	var st LatencyStats
+	if len(ds) == 0 {
+		return st
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	st.Count = len(ds)
+	st.Avg = sum / time.Duration(len(ds))
+	st.P50 = percentile(ds, 0.50)
+	st.P95 = percentile(ds, 0.95)
+	st.P99 = percentile(ds, 0.99)
+	return st
+}
+
+// ds 已排序
+func percentile(ds []time.Duration, p float64) time.Duration {
+	return ds[int(float64(len(ds)-1)*p)]
+}
+
+// ErrorCount 失败的请求数（包含被拒绝的请求）
+func (m *methodType) ErrorCount() uint64 {
+	m.metrics.mu.Lock()
+	defer m.metrics.mu.Unlock()
+	var n uint64
+	for _, c := range m.metrics.errors {
+		n += c
+	}
+	return n
+}
+
+// LastError 最近一次失败的错误信息
+func (m *methodType) LastError() string {
+	m.metrics.mu.Lock()
+	defer m.metrics.mu.Unlock()
+	return m.metrics.lastError
+}
+
+// InFlight 正在处理的请求数
+func (m *methodType) InFlight() int64 {
+	return atomic.LoadInt64(&m.metrics.inflight)
+}
+
+// Latency 最近一分钟内的延迟统计
+func (m *methodType) Latency() LatencyStats {
+	m.metrics.mu.Lock()
+	defer m.metrics.mu.Unlock()
+	return m.metrics.recent.stats(time.Now())
+}
@@ -0,0 +1,138 @@
+/**
+ * @Author : liangliangtoo
+ * @File : status
+ * @Date: 2026/10/18 17:40
+ * @Description: 错误码，随响应头在服务端与客户端之间传递
+ */
+package Trpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/LucienVen/Trpc/core"
+)
+
+// Code 错误码
+type Code uint32
+
+const (
+	CodeOK                Code = iota
+	CodeCanceled               // 调用方取消
+	CodeUnknown                // 处理函数返回的普通错误
+	CodeInvalidArgument        // 请求无法解析
+	CodeDeadlineExceeded       // 超时
+	CodeNotFound               // 服务或方法不存在
+	CodeResourceExhausted      // 服务端过载或被限流
+	CodeUnavailable            // 连接不可用，或服务端暂时无法处理
+	CodeInternal               // 框架内部错误
+)
+
+var codeNames = map[Code]string{
+	CodeOK:                "OK",
+	CodeCanceled:          "Canceled",
+	CodeUnknown:           "Unknown",
+	CodeInvalidArgument:   "InvalidArgument",
+	CodeDeadlineExceeded:  "DeadlineExceeded",
+	CodeNotFound:          "NotFound",
+	CodeResourceExhausted: "ResourceExhausted",
+	CodeUnavailable:       "Unavailable",
+	CodeInternal:          "Internal",
+}
+
+func (c Code) String() string {
+	if name, ok := codeNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("Code(%d)", uint32(c))
+}
+
+// Error 带错误码的错误，处理函数返回 *Error 时错误码会传递给客户端
+type Error struct {
+	Code    Code
+	Message string
+	Meta    map[string]string // 随错误一起写入响应头的元数据
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Errorf 创建带错误码的错误
+func Errorf(code Code, format string, a ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, a...)}
+}
+
+// ErrorCode 返回错误对应的错误码，连接相关的错误视为 CodeUnavailable
+func ErrorCode(err error) Code {
+	if err == nil {
+		return CodeOK
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return CodeCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return CodeDeadlineExceeded
+	case errors.Is(err, ErrPoolExhausted):
+		return CodeResourceExhausted
+	case errors.Is(err, ErrShutdown), errors.Is(err, ErrKeepaliveTimeout),
+		errors.Is(err, ErrReconnecting), errors.Is(err, ErrReconnectQueueFull),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.EPIPE):
+		return CodeUnavailable
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return CodeUnavailable
+	}
+	return CodeUnknown
+}
+
+// 调用方的上下文结束时返回的错误
+func contextError(prefix string, ctx context.Context) *Error {
+	code := CodeCanceled
+	if ctx.Err() == context.DeadlineExceeded {
+		code = CodeDeadlineExceeded
+	}
+	return Errorf(code, "%s: %s", prefix, ctx.Err().Error())
+}
+
+// 将错误写入响应头
+func setHeaderError(h *core.Header, err error) {
+	h.Error = err.Error()
+	h.Code = uint32(ErrorCode(err))
+
+	var e *Error
+	if errors.As(err, &e) && len(e.Meta) > 0 {
+		if h.Meta == nil {
+			h.Meta = make(map[string]string, len(e.Meta))
+		}
+		for k, v := range e.Meta {
+			h.Meta[k] = v
+		}
+	}
+}
+
+// 从响应头中恢复错误
+func headerError(h *core.Header) error {
+	if h.Error == "" {
+		return nil
+	}
+
+	code := Code(h.Code)
+	if code == CodeOK {
+		code = CodeUnknown
+	}
+	return &Error{Code: code, Message: h.Error, Meta: h.Meta}
+}
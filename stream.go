@@ -0,0 +1,331 @@
+/**
+ * @Author : liangliangtoo
+ * @File : stream
+ * @Date: 2026/10/18 10:20
+ * @Description: 客户端流与双向流，复用 Client 已有的连接
+ */
+package Trpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/LucienVen/Trpc/core"
+)
+
+/**
+流的生命周期（Seq 即流ID）：
+	client --- KindStreamOpen  ---> server  启动处理函数
+	client <-- KindStreamData  --> server  双向发送消息
+	client --- KindStreamClose ---> server  客户端半关闭，服务端 Recv 返回 io.EOF
+	client <-- KindStreamClose --- server  处理函数返回，携带最终错误
+流控：每一端最多有 window 条未被对端消费的消息，对端消费后通过 KindStreamWindow 归还窗口
+*/
+
+// 默认流窗口大小（未被对端消费的消息数量）
+const defaultStreamWindow = 64
+
+var ErrStreamClosed = errors.New("rpc: stream is closed")
+
+var errStreamReset = errors.New("rpc: stream reset by peer")
+
+var errStreamOverflow = errors.New("rpc: stream flow control window exceeded")
+
+// stream 客户端流和服务端流的公共实现
+type stream struct {
+	id     uint64
+	method string
+	codec  core.Ttype
+	window int
+	write  func(h *core.Header, body interface{}) error // 在连接的发送锁下写出一帧
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	recvCh  chan []byte   // 已收到但未消费的消息，容量为窗口大小
+	credits chan struct{} // 剩余的发送窗口
+	done    chan struct{} // 流结束后关闭
+
+	mu         sync.Mutex
+	consumed   int   // 已消费但尚未归还给对端的窗口
+	recvClosed bool  // 对端不会再发送消息
+	recvErr    error // 接收结束的原因，io.EOF 表示对端正常半关闭
+	sendClosed bool
+	err        error // 流结束的原因
+}
+
+func newStream(ctx context.Context, id uint64, method string, codec core.Ttype, window int,
+	write func(*core.Header, interface{}) error) *stream {
+	if window <= 0 {
+		window = defaultStreamWindow
+	}
+
+	s := &stream{
+		id:      id,
+		method:  method,
+		codec:   codec,
+		window:  window,
+		write:   write,
+		recvCh:  make(chan []byte, window),
+		credits: make(chan struct{}, window),
+		done:    make(chan struct{}),
+	}
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	for i := 0; i < window; i++ {
+		s.credits <- struct{}{}
+	}
+
+	return s
+}
+
+func (s *stream) header(kind core.Kind) *core.Header {
+	return &core.Header{ServiceMethod: s.method, Seq: s.id, Kind: kind}
+}
+
+// 发送一条消息，窗口耗尽时阻塞等待对端消费
+func (s *stream) send(v interface{}) error {
+	s.mu.Lock()
+	sendClosed := s.sendClosed
+	s.mu.Unlock()
+	if sendClosed {
+		return ErrStreamClosed
+	}
+
+	data, err := core.Marshal(s.codec, v)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-s.credits:
+	case <-s.done:
+		return s.doneErr()
+	}
+
+	return s.write(s.header(core.KindStreamData), data)
+}
+
+// 半关闭：不再发送消息，但仍可接收，err 为流的最终错误（仅服务端使用）
+func (s *stream) closeSend(err error) error {
+	s.mu.Lock()
+	if s.sendClosed {
+		s.mu.Unlock()
+		return ErrStreamClosed
+	}
+	s.sendClosed = true
+	s.mu.Unlock()
+
+	h := s.header(core.KindStreamClose)
+	if err != nil {
+		setHeaderError(h, err)
+	}
+	return s.write(h, invalidRequest)
+}
+
+// 接收一条消息，对端半关闭且消息消费完后返回 recvErr
+func (s *stream) recv(v interface{}) error {
+	data, ok := <-s.recvCh
+	if !ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.recvErr
+	}
+
+	s.ack()
+	return core.Unmarshal(s.codec, data, v)
+}
+
+// 消费一条消息，累计到半个窗口后归还给对端
+func (s *stream) ack() {
+	s.mu.Lock()
+	s.consumed++
+	n := s.consumed
+	if n < (s.window+1)/2 || s.recvClosed {
+		s.mu.Unlock()
+		return
+	}
+	s.consumed = 0
+	s.mu.Unlock()
+
+	_ = s.write(s.header(core.KindStreamWindow), uint32(n))
+}
+
+// 以下方法由连接的读循环调用，不能在其中写连接
+
+// 投递一条对端发来的消息，返回 false 表示对端不遵守窗口，
+// 调用方需要先移除流，再调用 overflow 中止
+func (s *stream) deliver(data []byte) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.recvClosed {
+		return true
+	}
+
+	select {
+	case s.recvCh <- data:
+		return true
+	default:
+		return false
+	}
+}
+
+// 对端不遵守窗口，中止流并通知对端
+func (s *stream) overflow() {
+	s.abort(errStreamOverflow)
+	go func() {
+		_ = s.write(s.header(core.KindStreamReset), invalidRequest)
+	}()
+}
+
+// 对端归还发送窗口
+func (s *stream) addCredit(n uint32) {
+	for i := uint32(0); i < n; i++ {
+		select {
+		case s.credits <- struct{}{}:
+		default:
+			return
+		}
+	}
+}
+
+// 对端不再发送消息
+func (s *stream) closeRecv(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.recvClosed {
+		return
+	}
+	s.recvClosed = true
+	s.recvErr = err
+	close(s.recvCh)
+}
+
+// 结束流，唤醒所有等待中的发送与接收
+func (s *stream) abort(err error) {
+	s.closeRecv(err)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return
+	}
+	s.err = err
+	s.sendClosed = true
+	close(s.done)
+	s.cancel()
+}
+
+func (s *stream) doneErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+/** 客户端流 **/
+
+// ClientStream 客户端持有的流，Send/Recv 可以在不同 goroutine 中并发调用
+type ClientStream struct {
+	*stream
+	client *Client
+}
+
+// NewStream 在已有连接上打开一个到 serviceMethod 的流
+// ctx 结束时流被中止，服务端会收到 KindStreamReset
+func (client *Client) NewStream(ctx context.Context, serviceMethod string) (*ClientStream, error) {
+	cs, err := client.registerStream(ctx, serviceMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	seq := cs.id
+	if err = cs.write(cs.header(core.KindStreamOpen), invalidRequest); err != nil {
+		client.removeStream(seq)
+		cs.abort(err)
+		return nil, err
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-cs.done:
+			return
+		}
+
+		// 调用方取消，通知服务端中止
+		if client.removeStream(seq) != nil {
+			_ = cs.write(cs.header(core.KindStreamReset), invalidRequest)
+		}
+		cs.abort(contextError("rpc client: stream canceled", ctx))
+	}()
+
+	return cs, nil
+}
+
+// Send 发送一条消息
+func (cs *ClientStream) Send(args interface{}) error {
+	return cs.send(args)
+}
+
+// CloseSend 半关闭，服务端的 Recv 将返回 io.EOF
+func (cs *ClientStream) CloseSend() error {
+	return cs.closeSend(nil)
+}
+
+// Recv 接收一条消息，服务端正常结束时返回 io.EOF，否则返回服务端的错误
+func (cs *ClientStream) Recv(reply interface{}) error {
+	return cs.recv(reply)
+}
+
+// CloseAndRecv 用于上传式的流：半关闭后等待服务端唯一的一条回复
+func (cs *ClientStream) CloseAndRecv(reply interface{}) error {
+	if err := cs.CloseSend(); err != nil {
+		return err
+	}
+
+	if err := cs.Recv(reply); err != nil {
+		if err == io.EOF {
+			return errors.New("rpc client: stream closed without reply")
+		}
+		return err
+	}
+
+	// 等待服务端结束，获取最终错误
+	var extra struct{}
+	if err := cs.recv(&extra); err != io.EOF {
+		if err == nil {
+			return errors.New("rpc client: stream sent more than one reply")
+		}
+		return err
+	}
+	return nil
+}
+
+// Context 返回流的上下文
+func (cs *ClientStream) Context() context.Context {
+	return cs.ctx
+}
+
+/** 服务端流 **/
+
+// ServerStream 处理函数持有的流，流方法的签名为 func (t *T) Method(stream *ServerStream) error
+type ServerStream struct {
+	*stream
+}
+
+// Recv 接收一条消息，客户端半关闭后返回 io.EOF
+func (ss *ServerStream) Recv(args interface{}) error {
+	return ss.recv(args)
+}
+
+// Send 向客户端发送一条消息
+func (ss *ServerStream) Send(reply interface{}) error {
+	return ss.send(reply)
+}
+
+// Context 返回流的上下文，客户端中止或连接断开时结束
+func (ss *ServerStream) Context() context.Context {
+	return ss.ctx
+}
@@ -0,0 +1,190 @@
+/**
+ * @Author : liangliangtoo
+ * @File : stream_test
+ * @Date: 2026/10/18 11:02
+ * @Description:
+ */
+package Trpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/LucienVen/Trpc/core"
+)
+
+type Stream int
+
+// 客户端流：累加所有收到的数，结束后回复一次
+func (s Stream) Sum(stream *ServerStream) error {
+	total := 0
+	for {
+		var n int
+		err := stream.Recv(&n)
+		if err == io.EOF {
+			return stream.Send(total)
+		}
+		if err != nil {
+			return err
+		}
+		total += n
+	}
+}
+
+// 双向流：原样返回收到的每一条消息
+func (s Stream) Echo(stream *ServerStream) error {
+	for {
+		var msg string
+		err := stream.Recv(&msg)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = stream.Send(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func startStreamServer(t *testing.T) string {
+	server := NewServer()
+	var s Stream
+	_ = server.Register(&s)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("failed to listen:", err)
+	}
+	go server.Accept(l)
+	return l.Addr().String()
+}
+
+func TestClient_NewStream(t *testing.T) {
+	t.Parallel()
+
+	addr := startStreamServer(t)
+	// 小窗口确保流控生效
+	client, err := Dial("tcp", addr, &Option{StreamWindow: 2})
+	_assert(err == nil, "failed to dial: %v", err)
+	defer func() { _ = client.Close() }()
+
+	t.Run("client streaming", func(t *testing.T) {
+		stream, err := client.NewStream(context.Background(), "Stream.Sum")
+		_assert(err == nil, "failed to open stream: %v", err)
+		for i := 1; i <= 100; i++ {
+			_assert(stream.Send(i) == nil, "failed to send")
+		}
+
+		var total int
+		err = stream.CloseAndRecv(&total)
+		_assert(err == nil && total == 5050, "expect 5050, but got %d (%v)", total, err)
+	})
+
+	t.Run("bidirectional", func(t *testing.T) {
+		stream, err := client.NewStream(context.Background(), "Stream.Echo")
+		_assert(err == nil, "failed to open stream: %v", err)
+
+		go func() {
+			for _, msg := range []string{"a", "b", "c"} {
+				_ = stream.Send(msg)
+			}
+			_ = stream.CloseSend()
+		}()
+
+		var got []string
+		for {
+			var msg string
+			err := stream.Recv(&msg)
+			if err == io.EOF {
+				break
+			}
+			_assert(err == nil, "failed to recv: %v", err)
+			got = append(got, msg)
+		}
+		_assert(len(got) == 3 && got[2] == "c", "unexpected echo %v", got)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		stream, err := client.NewStream(ctx, "Stream.Echo")
+		_assert(err == nil, "failed to open stream: %v", err)
+		cancel()
+
+		var msg string
+		done := make(chan error, 1)
+		go func() { done <- stream.Recv(&msg) }()
+		select {
+		case err = <-done:
+			_assert(err != nil && err != io.EOF, "expect a canceled error, but got %v", err)
+		case <-time.After(time.Second):
+			t.Fatal("recv is not interrupted by cancel")
+		}
+	})
+
+	t.Run("unknown method", func(t *testing.T) {
+		stream, err := client.NewStream(context.Background(), "Stream.Nope")
+		_assert(err == nil, "failed to open stream: %v", err)
+		var msg string
+		err = stream.Recv(&msg)
+		_assert(err != nil && err != io.EOF, "expect a method error, but got %v", err)
+	})
+
+	// 流结束后普通调用仍然可用
+	_assert(client.IsAvailable(), "client should be available")
+}
+
+type Hold chan struct{}
+
+// 不消费任何消息，直到测试结束
+func (h Hold) Wait(stream *ServerStream) error {
+	<-h
+	return nil
+}
+
+func TestStream_Overflow(t *testing.T) {
+	t.Parallel()
+
+	server := NewServer()
+	hold := make(Hold)
+	defer close(hold)
+	_ = server.Register(hold)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "failed to listen: %v", err)
+	go server.Accept(l)
+
+	client, err := Dial("tcp", l.Addr().String(), &Option{StreamWindow: 2})
+	_assert(err == nil, "failed to dial: %v", err)
+	defer func() { _ = client.Close() }()
+
+	stream, err := client.NewStream(context.Background(), "Hold.Wait")
+	_assert(err == nil, "failed to open stream: %v", err)
+
+	// 绕过发送窗口，发送超过窗口的消息
+	data, _ := core.Marshal(stream.codec, 1)
+	for i := 0; i < 3; i++ {
+		_assert(stream.write(stream.header(core.KindStreamData), data) == nil, "failed to write")
+	}
+
+	var n int
+	err = stream.Recv(&n)
+	_assert(err != nil && err != io.EOF, "expect a reset error, but got %v", err)
+
+	// 服务端处理函数仍未返回，流也必须从两端的表中移除
+	server.connMu.Lock()
+	for _, sc := range server.conns {
+		sc.mu.Lock()
+		_assert(len(sc.streams) == 0, "expect no server stream, but got %d", len(sc.streams))
+		sc.mu.Unlock()
+	}
+	server.connMu.Unlock()
+
+	client.mu.Lock()
+	_assert(len(client.streams) == 0, "expect no client stream, but got %d", len(client.streams))
+	client.mu.Unlock()
+}
@@ -0,0 +1,221 @@
+/**
+ * @Author : liangliangtoo
+ * @File : trace
+ * @Date: 2026/10/19 00:50
+ * @Description: 链路追踪，trace 上下文随请求头元数据传递
+ */
+package Trpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	mrand "math/rand"
+
+	"github.com/LucienVen/Trpc/core"
+)
+
+/**
+使用方式：
+	exporter, _ := Trpc.OpenJSONLExporter("spans.jsonl")
+	tracer := &Trpc.Tracer{Exporter: exporter}
+	server.Tracer = tracer
+	client, _ := Trpc.Dial("tcp", addr, &Trpc.Option{Tracer: tracer, ...})
+客户端为每次 Call 创建子 span，服务端在处理函数外继续该 trace，
+处理函数使用收到的 ctx 继续调用下游服务时，trace 会沿调用链传递。
+未配置 Tracer 的一方只透传 trace 上下文，不产生 span。
+目前只追踪普通调用与单向调用
+*/
+
+// 请求头元数据：trace 上下文
+const (
+	MetaTraceID = "trace-id"
+	MetaSpanID  = "span-id"
+	MetaSampled = "sampled"
+)
+
+// SpanContext 在进程间传递的 trace 上下文
+type SpanContext struct {
+	TraceID string
+	SpanID  string
+	Sampled bool
+}
+
+type spanKey struct{}
+
+// ContextWithSpan 返回携带 trace 上下文的 ctx
+func ContextWithSpan(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanKey{}, sc)
+}
+
+// SpanFromContext 返回 ctx 中的 trace 上下文
+func SpanFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanKey{}).(SpanContext)
+	return sc, ok
+}
+
+// 从请求头中读取 trace 上下文
+func headerSpan(h *core.Header) (SpanContext, bool) {
+	if h.Meta == nil || h.Meta[MetaTraceID] == "" {
+		return SpanContext{}, false
+	}
+	return SpanContext{
+		TraceID: h.Meta[MetaTraceID],
+		SpanID:  h.Meta[MetaSpanID],
+		Sampled: h.Meta[MetaSampled] == "1",
+	}, true
+}
+
+// 将 ctx 中的 trace 上下文写入请求头元数据
+func injectSpan(ctx context.Context, meta map[string]string) map[string]string {
+	sc, ok := SpanFromContext(ctx)
+	if !ok {
+		return meta
+	}
+	if meta == nil {
+		meta = make(map[string]string, 3)
+	}
+	meta[MetaTraceID] = sc.TraceID
+	meta[MetaSpanID] = sc.SpanID
+	meta[MetaSampled] = "0"
+	if sc.Sampled {
+		meta[MetaSampled] = "1"
+	}
+	return meta
+}
+
+// Span 一次调用在客户端或服务端的耗时记录
+type Span struct {
+	TraceID  string        `json:"traceId"`
+	SpanID   string        `json:"spanId"`
+	ParentID string        `json:"parentId,omitempty"`
+	Name     string        `json:"name"` // Service.Method
+	Kind     string        `json:"kind"` // client 或 server
+	Peer     string        `json:"peer,omitempty"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"` // 纳秒
+	Code     string        `json:"code"`
+	Error    string        `json:"error,omitempty"`
+
+	tracer *Tracer
+}
+
+// SpanExporter 导出结束的 span，需要支持并发调用
+type SpanExporter interface {
+	ExportSpan(span *Span) error
+}
+
+// Tracer 创建并导出 span
+type Tracer struct {
+	Exporter   SpanExporter
+	Logger     Logger  // 导出失败时的日志，默认 nil 代表不输出
+	SampleRate float64 // 新 trace 的采样率（0~1），默认0代表全部采样；已有 trace 沿用上游的采样结果
+}
+
+// 以 ctx 中的 trace 上下文为父节点创建 span，t 为 nil 时只透传父节点
+// 未采样时返回的 span 为 nil，但 ctx 中仍会携带新的 trace 上下文
+func (t *Tracer) start(ctx context.Context, name, kind, peer string) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	parent, ok := SpanFromContext(ctx)
+	sc := SpanContext{TraceID: parent.TraceID, SpanID: newSpanID(8), Sampled: parent.Sampled}
+	if !ok {
+		sc.TraceID = newSpanID(16)
+		sc.Sampled = t.SampleRate <= 0 || mrand.Float64() < t.SampleRate
+	}
+	ctx = ContextWithSpan(ctx, sc)
+	if !sc.Sampled {
+		return ctx, nil
+	}
+
+	return ctx, &Span{
+		TraceID:  sc.TraceID,
+		SpanID:   sc.SpanID,
+		ParentID: parent.SpanID,
+		Name:     name,
+		Kind:     kind,
+		Peer:     peer,
+		Start:    time.Now(),
+		tracer:   t,
+	}
+}
+
+// 结束并导出 span，span 为 nil 时忽略
+func (span *Span) end(err error) {
+	if span == nil {
+		return
+	}
+
+	span.Duration = time.Since(span.Start)
+	span.Code = ErrorCode(err).String()
+	if err != nil {
+		span.Error = err.Error()
+	}
+	if span.tracer.Exporter == nil {
+		return
+	}
+	if err := span.tracer.Exporter.ExportSpan(span); err != nil {
+		if logger := span.tracer.Logger; logger != nil {
+			logger.Log(LevelWarn, "rpc: export span error", F("err", err))
+		}
+	}
+}
+
+// 随机的十六进制 ID
+func newSpanID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+/** JSON Lines 导出 **/
+
+// JSONLExporter 每个 span 写为一行 JSON
+type JSONLExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONLExporter 将 span 写入 w
+func NewJSONLExporter(w io.Writer) *JSONLExporter {
+	return &JSONLExporter{w: w}
+}
+
+// OpenJSONLExporter 将 span 追加写入文件
+func OpenJSONLExporter(path string) (*JSONLExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return NewJSONLExporter(f), nil
+}
+
+func (e *JSONLExporter) ExportSpan(span *Span) error {
+	line, err := json.Marshal(span)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.w.Write(append(line, '\n'))
+	return err
+}
+
+// Close 关闭底层的 Writer（如果支持）
+func (e *JSONLExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if c, ok := e.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
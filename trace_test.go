@@ -0,0 +1,67 @@
+package Trpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+)
+
+type Relay struct {
+	client *Client
+}
+
+func (r *Relay) Sum(ctx context.Context, args Args, reply *int) error {
+	return r.client.Call(ctx, "Foo.Sum", args, reply)
+}
+
+func TestTracer(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	exporter := NewJSONLExporter(&buf)
+	tracer := &Tracer{Exporter: exporter}
+
+	start := func(rcvr interface{}) string {
+		server := NewServer()
+		server.Tracer = tracer
+		_ = server.Register(rcvr)
+		l, _ := net.Listen("tcp", "127.0.0.1:0")
+		go server.Accept(l)
+		return l.Addr().String()
+	}
+	var foo Foo
+	backend, _ := Dial("tcp", start(&foo), &Option{Tracer: tracer})
+	defer func() { _ = backend.Close() }()
+	client, _ := Dial("tcp", start(&Relay{client: backend}), &Option{Tracer: tracer})
+	defer func() { _ = client.Close() }()
+
+	var reply int
+	err := client.Call(context.Background(), "Relay.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "relay call failed: %v", err)
+
+	_ = exporter.Close()
+	spans := make(map[string]*Span)
+	var root *Span
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var span Span
+		_assert(json.Unmarshal(scanner.Bytes(), &span) == nil, "invalid span line %s", scanner.Text())
+		spans[span.SpanID] = &span
+		if span.ParentID == "" {
+			root = &span
+		}
+	}
+	_assert(len(spans) == 4, "expect 4 spans, but got %d", len(spans))
+	_assert(root != nil && root.Kind == "client" && root.Name == "Relay.Sum", "unexpected root span %+v", root)
+
+	// 每个 span 的父节点都在同一个 trace 中
+	for _, span := range spans {
+		_assert(span.TraceID == root.TraceID && span.Code == "OK", "unexpected span %+v", span)
+		if span != root {
+			_assert(spans[span.ParentID] != nil, "missing parent of %+v", span)
+		}
+	}
+}
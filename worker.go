@@ -0,0 +1,152 @@
+/**
+ * @Author : liangliangtoo
+ * @File : worker
+ * @Date: 2026/10/18 21:30
+ * @Description: 固定数量的 worker 执行请求，替代每个请求一个 goroutine
+ */
+package Trpc
+
+import (
+	"runtime"
+	"sync"
+)
+
+/**
+使用方式：
+	server.Workers = Trpc.NewWorkerPool(&Trpc.WorkerOption{Workers: 8, Fair: true})
+作用于普通调用、单向调用与批量调用中的每个请求，流仍然使用独立的 goroutine
+worker 总是优先取出高优先级的请求，同一优先级内按连接轮流（Fair）或先到先执行
+与 Limiter 同时使用时，请求获得并发名额后才进入 worker 队列，worker 不会等待名额
+处理函数在 worker 上执行，处理超时提前回复后 worker 仍被占用，直到处理函数返回
+*/
+
+// WorkerOption worker 池配置
+type WorkerOption struct {
+	Workers   int  // worker 数量，默认 runtime.NumCPU()
+	QueueSize int  // 最多排队的请求数，超出时回复 CodeResourceExhausted，默认 Workers 的64倍
+	Fair      bool // 按连接轮流取出请求，避免单个连接占满所有 worker
+}
+
+// WorkerPool 执行请求的 worker 池，可以被多个 Server 共用
+type WorkerPool struct {
+	opt WorkerOption
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	lanes  map[Priority]*lane // 有排队请求的优先级
+	queued int
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// 单个优先级的排队请求
+type lane struct {
+	queues map[interface{}][]func() // 按连接排队的请求，非公平模式下只有一个队列
+	ring   []interface{}            // 有排队请求的连接，按轮转顺序
+}
+
+// NewWorkerPool 创建并启动 worker 池，opt 为 nil 时使用默认配置
+func NewWorkerPool(opt *WorkerOption) *WorkerPool {
+	p := &WorkerPool{lanes: make(map[Priority]*lane)}
+	if opt != nil {
+		p.opt = *opt
+	}
+	if p.opt.Workers <= 0 {
+		p.opt.Workers = runtime.NumCPU()
+	}
+	if p.opt.QueueSize <= 0 {
+		p.opt.QueueSize = p.opt.Workers * 64
+	}
+	p.cond = sync.NewCond(&p.mu)
+
+	p.wg.Add(p.opt.Workers)
+	for i := 0; i < p.opt.Workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// 将请求加入 key 在该优先级下的队列
+func (p *WorkerPool) submit(key interface{}, priority Priority, task func()) error {
+	if !p.opt.Fair {
+		key = nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return Errorf(CodeUnavailable, "rpc server: worker pool is closed")
+	}
+	if p.queued >= p.opt.QueueSize {
+		return Errorf(CodeResourceExhausted, "rpc server: worker queue is full")
+	}
+
+	ln := p.lanes[priority]
+	if ln == nil {
+		ln = &lane{queues: make(map[interface{}][]func())}
+		p.lanes[priority] = ln
+	}
+	if len(ln.queues[key]) == 0 {
+		ln.ring = append(ln.ring, key)
+	}
+	ln.queues[key] = append(ln.queues[key], task)
+	p.queued++
+	p.cond.Signal()
+	return nil
+}
+
+// 从最高优先级中取出下一个请求，轮到的连接还有请求时排到末尾（需持有锁）
+func (p *WorkerPool) next() func() {
+	var priority Priority
+	var ln *lane
+	for pr, l := range p.lanes {
+		if ln == nil || pr > priority {
+			priority, ln = pr, l
+		}
+	}
+
+	key := ln.ring[0]
+	ln.ring = ln.ring[1:]
+
+	queue := ln.queues[key]
+	task := queue[0]
+	queue[0] = nil
+	if len(queue) == 1 {
+		delete(ln.queues, key)
+	} else {
+		ln.queues[key] = queue[1:]
+		ln.ring = append(ln.ring, key)
+	}
+	if len(ln.ring) == 0 {
+		delete(p.lanes, priority)
+	}
+	p.queued--
+	return task
+}
+
+func (p *WorkerPool) work() {
+	defer p.wg.Done()
+	for {
+		p.mu.Lock()
+		for p.queued == 0 && !p.closed {
+			p.cond.Wait()
+		}
+		if p.queued == 0 {
+			p.mu.Unlock()
+			return
+		}
+		task := p.next()
+		p.mu.Unlock()
+
+		task()
+	}
+}
+
+// Close 停止接收新请求，等待已排队的请求执行完毕
+func (p *WorkerPool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+	p.wg.Wait()
+}
@@ -0,0 +1,131 @@
+package Trpc
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerPool(t *testing.T) {
+	t.Parallel()
+
+	p := NewWorkerPool(&WorkerOption{Workers: 1, QueueSize: 4, Fair: true})
+	gate := make(chan struct{})
+	_ = p.submit("busy", PriorityNormal, func() { <-gate })
+	time.Sleep(time.Millisecond * 10)
+
+	var mu sync.Mutex
+	var order []string
+	record := func(name string) func() {
+		return func() {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+		}
+	}
+	for i := 0; i < 3; i++ {
+		_ = p.submit("a", PriorityNormal, record("a"))
+	}
+	_ = p.submit("b", PriorityNormal, record("b"))
+	err := p.submit("b", PriorityNormal, record("b"))
+	_assert(ErrorCode(err) == CodeResourceExhausted, "expect CodeResourceExhausted, but got %v", err)
+
+	close(gate)
+	p.Close()
+	_assert(len(order) == 4 && order[0] == "a" && order[1] == "b", "connections should take turns, got %v", order)
+	_assert(ErrorCode(p.submit("a", PriorityNormal, func() {})) == CodeUnavailable, "closed pool should reject tasks")
+
+	// 高优先级的请求先执行
+	p = NewWorkerPool(&WorkerOption{Workers: 1})
+	gate = make(chan struct{})
+	_ = p.submit("busy", PriorityNormal, func() { <-gate })
+	time.Sleep(time.Millisecond * 10)
+	order = nil
+	_ = p.submit("a", PriorityBatch, record("batch"))
+	_ = p.submit("a", PriorityNormal, record("normal"))
+	_ = p.submit("b", PriorityInteractive, record("interactive"))
+	close(gate)
+	p.Close()
+	_assert(len(order) == 3 && order[0] == "interactive" && order[2] == "batch", "expect priority order, got %v", order)
+}
+
+type Counter struct {
+	active, peak int32
+}
+
+func (c *Counter) Work(args int, reply *int) error {
+	n := atomic.AddInt32(&c.active, 1)
+	defer atomic.AddInt32(&c.active, -1)
+	for {
+		peak := atomic.LoadInt32(&c.peak)
+		if n <= peak || atomic.CompareAndSwapInt32(&c.peak, peak, n) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond * 10)
+	*reply = args
+	return nil
+}
+
+func TestServer_Workers(t *testing.T) {
+	t.Parallel()
+
+	var counter Counter
+	server := NewServer()
+	server.Workers = NewWorkerPool(&WorkerOption{Workers: 2})
+	defer server.Workers.Close()
+	_ = server.Register(&counter)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+
+	client, _ := Dial("tcp", l.Addr().String())
+	defer func() { _ = client.Close() }()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var reply int
+			if err := client.Call(context.Background(), "Counter.Work", i, &reply); err != nil || reply != i {
+				t.Errorf("call failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	_assert(atomic.LoadInt32(&counter.peak) <= 2, "handlers should run on at most 2 workers, got %d", counter.peak)
+}
+
+func TestServer_WorkersTimeout(t *testing.T) {
+	t.Parallel()
+
+	gate := make(Gate)
+	var foo Foo
+	server := NewServer()
+	server.Workers = NewWorkerPool(&WorkerOption{Workers: 1, QueueSize: 4})
+	defer server.Workers.Close()
+	_ = server.Register(gate)
+	_ = server.Register(&foo)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+
+	client, _ := Dial("tcp", l.Addr().String(), &Option{HandleTimeout: time.Millisecond * 50})
+	defer func() { _ = client.Close() }()
+
+	// 超时回复后处理函数仍占用唯一的 worker，后续请求需要等它返回
+	err := client.Call(context.Background(), "Gate.Wait", 1, new(int))
+	_assert(ErrorCode(err) == CodeDeadlineExceeded, "expect CodeDeadlineExceeded, but got %v", err)
+	call := client.Go("Foo.Sum", Args{1, 2}, new(int), nil)
+	select {
+	case <-call.Done:
+		t.Fatal("handler should not run while the timed-out handler holds the worker")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	close(gate)
+	call = <-call.Done
+	_assert(call.Error == nil && *call.Reply.(*int) == 3, "call failed: %v", call.Error)
+}